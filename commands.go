@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/andrewchambers/g/driver"
+	"github.com/andrewchambers/g/emit"
+	"github.com/andrewchambers/g/target"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// Subcommands are run as g <command> [flags] args, without one g
+// compiles a single package to llvm text.
+var commands = map[string]func(args []string) int{
+	"build": cmdBuild,
+	"run":   cmdRun,
+	"test":  cmdTest,
+	"clean": cmdClean,
+}
+
+var commandUsage = `Commands:
+  g build [flags] package        compile and link an executable
+  g run [flags] package [args]   build and run an executable
+  g test [flags] package...      build and run programs, they pass if they exit with 0
+  g clean -cache                 remove the build cache
+`
+
+// Flags shared by the subcommands which build executables.
+type buildFlags struct {
+	fs         *flag.FlagSet
+	searchPath stringList
+	allocator  *string
+	cacheDir   *string
+	keepWork   *bool
+	verbose    *bool
+	jobs       *int
+}
+
+func newBuildFlags(name string) *buildFlags {
+	bf := &buildFlags{fs: flag.NewFlagSet(name, flag.ExitOnError)}
+	bf.fs.Var(&bf.searchPath, "I", "Directory searched for imported packages, may be repeated. Defaults to the current directory.")
+	bf.allocator = bf.fs.String("allocator", "calloc", "Function called by new, it must behave like calloc.")
+	bf.cacheDir = bf.fs.String("cachedir", driver.DefaultCacheDir(), "Directory of the build cache, empty to disable it. Defaults to $GCACHE.")
+	bf.keepWork = bf.fs.Bool("work", false, "Keep the work directory holding intermediate files.")
+	bf.jobs = bf.fs.Int("j", runtime.NumCPU(), "The number of files parsed or packages compiled at once.")
+	bf.verbose = bf.fs.Bool("v", false, "Print the commands run and build cache statistics.")
+	return bf
+}
+
+func (bf *buildFlags) options() driver.BuildOptions {
+	searchPath := bf.searchPath
+	if len(searchPath) == 0 {
+		searchPath = stringList{"."}
+	}
+	return driver.BuildOptions{
+		Options: driver.Options{
+			SearchPath: searchPath,
+			Emit:       emit.Options{Allocator: *bf.allocator},
+			Jobs:       *bf.jobs,
+		},
+		CacheDir: *bf.cacheDir,
+		KeepWork: *bf.keepWork,
+		Verbose:  *bf.verbose,
+	}
+}
+
+func cmdBuild(args []string) int {
+	bf := newBuildFlags("build")
+	output := bf.fs.String("o", "", "Path of the executable, defaults to the package name.")
+	bf.fs.Parse(args)
+	if bf.fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: g build [flags] package")
+		return 2
+	}
+	opts := bf.options()
+	opts.Output = *output
+	err := driver.Build(target.GetTarget(), opts, bf.fs.Arg(0))
+	if err != nil {
+		reportError(err)
+		fmt.Fprintln(os.Stderr, "build failed.")
+		return 1
+	}
+	return 0
+}
+
+func cmdRun(args []string) int {
+	bf := newBuildFlags("run")
+	bf.fs.Parse(args)
+	if bf.fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "usage: g run [flags] package [args]")
+		return 2
+	}
+	err := driver.Run(target.GetTarget(), bf.options(), bf.fs.Arg(0), bf.fs.Args()[1:])
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// The program ran, pass on its exit code.
+		if code := exitErr.ExitCode(); code >= 0 {
+			return code
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err != nil {
+		reportError(err)
+		fmt.Fprintln(os.Stderr, "build failed.")
+		return 1
+	}
+	return 0
+}
+
+func cmdTest(args []string) int {
+	bf := newBuildFlags("test")
+	bf.fs.Parse(args)
+	if bf.fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: g test [flags] package...")
+		return 2
+	}
+	binDir, err := ioutil.TempDir("", "g-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(binDir)
+
+	failed := 0
+	for idx, pkg := range bf.fs.Args() {
+		opts := bf.options()
+		opts.Output = filepath.Join(binDir, fmt.Sprintf("test%d", idx))
+		err := driver.Build(target.GetTarget(), opts, pkg)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s (build failed)\n", pkg)
+			reportError(err)
+			continue
+		}
+		var out bytes.Buffer
+		cmd := exec.Command(opts.Output)
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		err = cmd.Run()
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s (%s)\n", pkg, err)
+			os.Stdout.Write(out.Bytes())
+			continue
+		}
+		fmt.Printf("ok   %s\n", pkg)
+	}
+	if failed != 0 {
+		fmt.Printf("%d of %d failed\n", failed, bf.fs.NArg())
+		return 1
+	}
+	return 0
+}
+
+func cmdClean(args []string) int {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	cache := fs.Bool("cache", false, "Remove the build cache.")
+	cacheDir := fs.String("cachedir", driver.DefaultCacheDir(), "Directory of the build cache. Defaults to $GCACHE.")
+	fs.Parse(args)
+	if fs.NArg() != 0 || !*cache {
+		fmt.Fprintln(os.Stderr, "usage: g clean -cache [-cachedir dir]")
+		return 2
+	}
+	if *cacheDir == "" {
+		return 0
+	}
+	err := driver.CleanCache(*cacheDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
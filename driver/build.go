@@ -0,0 +1,282 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/andrewchambers/g/emit"
+	"github.com/andrewchambers/g/target"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Options for building an executable. ExportDir is not used, packages are
+// compiled from source or found in the build cache.
+type BuildOptions struct {
+	Options
+	// Directory of the build cache, empty disables it.
+	CacheDir string
+	// Path of the executable, empty means the name of the package folder
+	// or source file in the current directory.
+	Output string
+	// Keep the work directory holding the intermediate files.
+	KeepWork bool
+	// Print the commands run, the work directory and build cache
+	// statistics to stderr.
+	Verbose bool
+}
+
+// The external tools turning LLVM text into an executable. clang does
+// everything, without it llc assembles and the system C compiler links.
+type toolchain struct {
+	clang string
+	llc   string
+	cc    string
+	// Where the commands run are printed, nil for nowhere.
+	log io.Writer
+}
+
+func findToolchain() (*toolchain, error) {
+	if clang, err := exec.LookPath("clang"); err == nil {
+		return &toolchain{clang: clang}, nil
+	}
+	llc, err := exec.LookPath("llc")
+	if err != nil {
+		return nil, errors.New("neither clang nor llc was found in PATH")
+	}
+	for _, name := range []string{"cc", "gcc"} {
+		if cc, err := exec.LookPath(name); err == nil {
+			return &toolchain{llc: llc, cc: cc}, nil
+		}
+	}
+	return nil, errors.New("clang was not found in PATH and there is no C compiler to link with")
+}
+
+// Run a tool, its stderr is returned in the error if it fails.
+func (tc *toolchain) run(name string, args ...string) error {
+	if tc.log != nil {
+		fmt.Fprintln(tc.log, name, strings.Join(args, " "))
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return fmt.Errorf("%s failed: %s", filepath.Base(name), err)
+		}
+		return fmt.Errorf("%s failed: %s\n%s", filepath.Base(name), err, msg)
+	}
+	return nil
+}
+
+// Assemble LLVM text into an object file.
+func (tc *toolchain) assemble(llPath, objPath string) error {
+	if tc.clang != "" {
+		return tc.run(tc.clang, "-c", "-x", "ir", llPath, "-o", objPath)
+	}
+	return tc.run(tc.llc, "-relocation-model=pic", "-filetype=obj", llPath, "-o", objPath)
+}
+
+func (tc *toolchain) link(objPaths []string, outPath string) error {
+	linker := tc.clang
+	if linker == "" {
+		linker = tc.cc
+	}
+	args := append(append([]string{}, objPaths...), "-o", outPath)
+	return tc.run(linker, args...)
+}
+
+// The default name of the executable built from sourcePackage.
+func defaultOutput(sourcePackage string) string {
+	abs, err := filepath.Abs(sourcePackage)
+	if err != nil {
+		abs = sourcePackage
+	}
+	return strings.TrimSuffix(filepath.Base(abs), ".g")
+}
+
+// Build an executable from a main package and every package it imports.
+// Each package becomes its own LLVM module and object file in a work
+// directory, which is removed afterwards unless asked to keep it.
+func Build(machine target.TargetMachine, opts BuildOptions, sourcePackage string) error {
+	tc, err := findToolchain()
+	if err != nil {
+		return err
+	}
+	if opts.Verbose {
+		tc.log = os.Stderr
+	}
+
+	compileOpts := opts.Options
+	compileOpts.ExportDir = ""
+	imp := newImporter(machine, compileOpts)
+	if opts.CacheDir != "" {
+		imp.cache, err = openCache(opts.CacheDir)
+		if err != nil {
+			return err
+		}
+	}
+	root, err := loadRootPackage(imp, sourcePackage)
+	if err != nil {
+		return err
+	}
+	if root.path != "main" {
+		return fmt.Errorf("%s is package %s, only package main can be built", sourcePackage, root.files[0].Pkg)
+	}
+
+	workDir, err := ioutil.TempDir("", "g-build")
+	if err != nil {
+		return err
+	}
+	if opts.KeepWork || opts.Verbose {
+		fmt.Fprintf(os.Stderr, "WORK=%s\n", workDir)
+	}
+	if !opts.KeepWork {
+		defer os.RemoveAll(workDir)
+	}
+
+	// Packages are compiled concurrently, each into the slots of its index,
+	// so the link order, the log and the error reported are the same
+	// whatever order they finish in.
+	order := imp.dependencyOrder(root.files)
+	var pkgs []*loadedPackage
+	for _, path := range order {
+		pkgs = append(pkgs, imp.sources[path])
+	}
+	pkgs = append(pkgs, root)
+	objPaths := make([]string, len(pkgs))
+	hits := make([]bool, len(pkgs))
+	errs := make([]error, len(pkgs))
+	logs := make([]bytes.Buffer, len(pkgs))
+	parallelFor(len(pkgs), opts.Jobs, func(idx int) {
+		jobTc := *tc
+		if tc.log != nil {
+			jobTc.log = &logs[idx]
+		}
+		pkg := pkgs[idx]
+		if pkg == nil {
+			// Loaded from the export data of a cache entry.
+			objPaths[idx], hits[idx] = imp.cache.get(imp.cacheKeys[order[idx]], cacheObject)
+			return
+		}
+		objPaths[idx], hits[idx], errs[idx] = compilePackage(machine, opts, &jobTc, imp.cache, pkg, idx, workDir)
+	})
+	for idx := range pkgs {
+		if tc.log != nil {
+			tc.log.Write(logs[idx].Bytes())
+		}
+		if errs[idx] != nil {
+			return errs[idx]
+		}
+	}
+	if imp.cache != nil && opts.Verbose {
+		nhits := 0
+		for _, hit := range hits {
+			if hit {
+				nhits++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "build cache: %d hits, %d misses\n", nhits, len(hits)-nhits)
+	}
+
+	output := opts.Output
+	if output == "" {
+		output = defaultOutput(sourcePackage)
+	}
+	return tc.link(objPaths, output)
+}
+
+// Compile a package to an object file in workDir, or find it in the cache.
+// Returns the path of the object file and whether it was cached.
+func compilePackage(machine target.TargetMachine, opts BuildOptions, tc *toolchain, cache *buildCache, pkg *loadedPackage, idx int, workDir string) (string, bool, error) {
+	if cache != nil {
+		if objPath, ok := cache.get(pkg.cacheKey, cacheObject); ok {
+			return objPath, true, nil
+		}
+	}
+	base := filepath.Join(workDir, fmt.Sprintf("%d.%s", idx, filepath.Base(pkg.path)))
+	err := emitPackage(machine, opts.Emit, pkg, base+".ll")
+	if err != nil {
+		return "", false, err
+	}
+	err = tc.assemble(base+".ll", base+".o")
+	if err != nil {
+		return "", false, err
+	}
+	if cache == nil {
+		return base + ".o", false, nil
+	}
+	// The object goes in first, an entry is only used once both exist.
+	err = cache.putFile(pkg.cacheKey, cacheObject, base+".o")
+	if err == nil && pkg.exportData != nil {
+		err = cache.put(pkg.cacheKey, cacheExport, bytes.NewReader(pkg.exportData))
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to write build cache: %s", err)
+	}
+	return base + ".o", false, nil
+}
+
+func emitPackage(machine target.TargetMachine, opts emit.Options, pkg *loadedPackage, llPath string) error {
+	out, err := os.Create(llPath)
+	if err != nil {
+		return err
+	}
+	err = emit.EmitModule(machine, opts, bufio.NewWriter(out), pkg.r, pkg.files)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Assemble an LLVM module into an object file.
+func AssembleLLVM(llvmFile string, objFile string) error {
+	tc, err := findToolchain()
+	if err != nil {
+		return err
+	}
+	return tc.assemble(llvmFile, objFile)
+}
+
+// Assemble and link a single LLVM module into an executable.
+func LinkLLVMToBinary(llvmFile string, outFile string) error {
+	tc, err := findToolchain()
+	if err != nil {
+		return err
+	}
+	objFile := outFile + ".o"
+	defer os.Remove(objFile)
+	err = tc.assemble(llvmFile, objFile)
+	if err != nil {
+		return err
+	}
+	return tc.link([]string{objFile}, outFile)
+}
+
+// Build a main package into a temporary executable and run it with args,
+// connected to the standard input and output. The exit status of the
+// program is returned as an *exec.ExitError.
+func Run(machine target.TargetMachine, opts BuildOptions, sourcePackage string, args []string) error {
+	binDir, err := ioutil.TempDir("", "g-run")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(binDir)
+	opts.Output = filepath.Join(binDir, defaultOutput(sourcePackage))
+	err = Build(machine, opts, sourcePackage)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(opts.Output, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,179 @@
+package driver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/andrewchambers/g/emit"
+	"github.com/andrewchambers/g/target"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const Version = "0.01"
+
+// The build cache holds the object file and export data of compiled
+// packages. Entries are addressed by a hash of everything compiling a
+// package depends on, so they never need invalidating: a change to the
+// package source, the export data of an import, the target or the compiler
+// gives a different key.
+type buildCache struct {
+	dir string
+}
+
+// Kinds of cache entry, the suffix of their file name.
+const (
+	cacheObject = "o"
+	cacheExport = "x"
+)
+
+// The default cache directory is $GCACHE, or g-build in the user cache
+// directory. GCACHE=off disables the cache.
+func DefaultCacheDir() string {
+	dir := os.Getenv("GCACHE")
+	if dir == "off" {
+		return ""
+	}
+	if dir != "" {
+		return dir
+	}
+	userDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(userDir, "g-build")
+}
+
+func openCache(dir string) (*buildCache, error) {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build cache: %s", err)
+	}
+	return &buildCache{dir: dir}, nil
+}
+
+// Remove every cache entry, then the cache directory if nothing else is in
+// it. Only the entry folders are removed in case the directory was
+// chosen badly.
+func CleanCache(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if !info.IsDir() || !isCacheBucket(info.Name()) {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	os.Remove(dir)
+	return nil
+}
+
+// Entries are spread over folders named by the first byte of their key.
+func isCacheBucket(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+func (c *buildCache) path(key, kind string) string {
+	return filepath.Join(c.dir, key[:2], key+"-"+kind)
+}
+
+// Returns the path of a cache entry if it exists.
+func (c *buildCache) get(key, kind string) (string, bool) {
+	path := c.path(key, kind)
+	_, err := os.Stat(path)
+	return path, err == nil
+}
+
+// Store data in the cache. Entries are written to a temporary file and
+// renamed into place, so they are complete once they exist.
+func (c *buildCache) put(key, kind string, data io.Reader) error {
+	path := c.path(key, kind)
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *buildCache) putFile(key, kind string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.put(key, kind, f)
+}
+
+var compilerIDOnce sync.Once
+var compilerID string
+
+// Identifies the running compiler. Released versions could use Version
+// alone, but a compiler built from changed source must not reuse the
+// output of the old one, so the executable is hashed too.
+func getCompilerID() string {
+	compilerIDOnce.Do(func() {
+		compilerID = Version
+		exe, err := os.Executable()
+		if err != nil {
+			return
+		}
+		f, err := os.Open(exe)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err == nil {
+			compilerID += " " + hex.EncodeToString(h.Sum(nil))
+		}
+	})
+	return compilerID
+}
+
+// The cache key of compiling the package with import path, given the hash
+// of its source and the hashes of the export data of its imports by path.
+func cacheKey(machine target.TargetMachine, opts emit.Options, path, sourceHash string, importHashes map[string]string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "compiler %s\n", getCompilerID())
+	fmt.Fprintf(h, "target %s\n", machine.LLVMTargetTriple())
+	fmt.Fprintf(h, "allocator %s\n", opts.Allocator)
+	fmt.Fprintf(h, "package %s\n", path)
+	fmt.Fprintf(h, "source %s\n", sourceHash)
+	var paths []string
+	for p := range importHashes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(h, "import %s %s\n", p, importHashes[p])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -2,16 +2,16 @@ package driver
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"github.com/andrewchambers/g/emit"
 	"github.com/andrewchambers/g/parse"
+	"github.com/andrewchambers/g/resolve"
 	"github.com/andrewchambers/g/target"
 	"github.com/andrewchambers/g/util"
 	"io"
-	"io/ioutil"
-	"bytes"
 	"os"
-	"os/exec"
+	"path/filepath"
 )
 
 func TokenizeFile(sourceFile string, out io.WriteCloser) error {
@@ -27,7 +27,7 @@ func TokenizeFile(sourceFile string, out io.WriteCloser) error {
 			return nil
 		}
 		if tok.Kind == parse.ERROR {
-			return fmt.Errorf(tok.Val)
+			return fmt.Errorf("%s", tok.Val)
 		}
 		fmt.Fprintf(out, "%s:%s:%d:%d\n", tok.Kind, tok.Val, tok.Span.Start.Line, tok.Span.Start.Col)
 	}
@@ -55,16 +55,32 @@ func GetPackageName(sourceFile string) (string, error) {
 }
 
 func ParseFolder(folder string) ([]*parse.File, error) {
-	rfile, rerr := make([]*parse.File, 0, 16), make(util.ErrorList, 0, 16)
+	return parseFolder(folder, 0)
+}
+
+// Parse the files of a folder, up to jobs at once.
+func parseFolder(folder string, jobs int) ([]*parse.File, error) {
 	filePaths, err := util.GFilesInDir(folder)
 	if err != nil {
-		return rfile, err
-	}
-	for _, path := range filePaths {
-		f, err := ParseFile(path)
-		if err != nil {
-			rerr = append(rerr, err)
-		} else {
+		return make([]*parse.File, 0), err
+	}
+	files := make([]*parse.File, len(filePaths))
+	errs := make([]error, len(filePaths))
+	parallelFor(len(filePaths), jobs, func(i int) {
+		files[i], errs[i] = ParseFile(filePaths[i])
+	})
+	return collectParsed(files, errs)
+}
+
+// Gather the results of parsing the files of a folder, in file order.
+func collectParsed(files []*parse.File, errs []error) ([]*parse.File, error) {
+	rfile, rerr := make([]*parse.File, 0, 16), make(util.ErrorList, 0, 16)
+	for idx, f := range files {
+		if errs[idx] != nil {
+			rerr = append(rerr, errs[idx])
+		}
+		// Files with syntax errors are still partially parsed.
+		if f != nil {
 			rfile = append(rfile, f)
 		}
 	}
@@ -79,55 +95,113 @@ func ParseFile(sourceFile string) (*parse.File, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Failed to open source file %s for lexing: %s\n", sourceFile, err)
 	}
+	defer f.Close()
 	tokChan, _ := parse.Lex(sourceFile, f)
-	ast, err := parse.Parse(tokChan)
-	if err != nil {
-		return nil, fmt.Errorf("parse error: %s", err)
-	}
-	return ast, nil
+	return parse.Parse(tokChan)
 }
 
 func ParseString(source string) (*parse.File, error) {
 	b := bytes.NewBufferString(source)
-	tokChan, _ := parse.Lex("unknown",b)
-	ast, err := parse.Parse(tokChan)
-	if err != nil {
-		return nil, fmt.Errorf("parse error: %s", err)
-	}
-	return ast, nil
+	tokChan, _ := parse.Lex("unknown", b)
+	return parse.Parse(tokChan)
+}
+
+// Options for compiling a package.
+type Options struct {
+	// Directories searched for imported packages, in order.
+	SearchPath []string
+	// Directory holding export data, written for the compiled package and
+	// read for its imports when up to date. Empty disables export data.
+	ExportDir string
+	Emit      emit.Options
+	// The number of files parsed or packages compiled at once, 0 means
+	// one per CPU.
+	Jobs int
 }
 
-func CompilePackageToLLVM(machine target.TargetMachine, sourcePackage string, out io.Writer) error {
-	ast, err := ParseFolder(sourcePackage)
+// Compile a package to llvm text. sourcePackage is either a folder of .g files
+// or a single .g file. Imported packages are resolved, or loaded from their
+// export data, but not compiled.
+func CompilePackageToLLVM(machine target.TargetMachine, opts Options, sourcePackage string, out io.Writer) error {
+	imp := newImporter(machine, opts)
+	pkg, err := loadRootPackage(imp, sourcePackage)
 	if err != nil {
 		return err
 	}
-	err = emit.EmitModule(machine, bufio.NewWriter(out), ast)
-	if err != nil {
-		return err
+	if opts.ExportDir != "" && pkg.path != "main" {
+		err = imp.writeExportData(imp.exportHeader(pkg.sourceHash, pkg.files), pkg.r.Package())
+		if err != nil {
+			return fmt.Errorf("failed to write export data: %s", err)
+		}
 	}
-	return nil
+	return emit.EmitModule(machine, opts.Emit, bufio.NewWriter(out), pkg.r, pkg.files)
+}
+
+// A package parsed and resolved from source.
+type loadedPackage struct {
+	path       string
+	sourceHash string
+	files      []*parse.File
+	r          *resolve.Resolver
+
+	// Set when building with a cache, the package has not been found in
+	// it and is stored under cacheKey once compiled.
+	cacheKey   string
+	exportData []byte
 }
 
-func LinkLLVMToBinary(llvmFile string, outFile string) error {
-	cmd := exec.Command("clang", llvmFile, "-o", outFile)
-	clangErrorPipe, err := cmd.StderrPipe()
+// Parse and resolve the package named on the command line, importing
+// its dependencies with imp.
+func loadRootPackage(imp *importer, sourcePackage string) (*loadedPackage, error) {
+	isDir, err := util.IsDirectory(sourcePackage)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var ast []*parse.File
+	if isDir {
+		ast, err = parseFolder(sourcePackage, imp.jobs)
+	} else {
+		var f *parse.File
+		f, err = ParseFile(sourcePackage)
+		ast = []*parse.File{f}
 	}
-	err = cmd.Start()
 	if err != nil {
-		return err
+		return nil, flattenErrors(err)
+	}
+	if len(ast) == 0 {
+		return nil, fmt.Errorf("no .g files in %s", sourcePackage)
+	}
+	dir := sourcePackage
+	var sourceHash string
+	if isDir {
+		sourceHash, err = hashSources(sourcePackage)
+	} else {
+		dir = filepath.Dir(sourcePackage)
+		sourceHash, err = hashFiles([]string{sourcePackage})
 	}
-
-	errorBytes, err := ioutil.ReadAll(clangErrorPipe)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	err = cmd.Wait()
+	path := ast[0].Pkg
+	if path != "main" {
+		path = imp.importPathOf(dir, path)
+	}
+	imp.preload(ast)
+	imp.importing = append(imp.importing, path)
+	r := resolve.New(imp.machine, imp)
+	err = r.ResolvePackage(path, ast)
 	if err != nil {
-		return fmt.Errorf("%s", errorBytes)
+		return nil, dedupDiagnostics(err)
 	}
-	return nil
+	pkg := &loadedPackage{
+		path:       path,
+		sourceHash: sourceHash,
+		files:      ast,
+		r:          r,
+	}
+	err = imp.prepareCacheEntry(pkg)
+	if err != nil {
+		return nil, err
+	}
+	return pkg, nil
 }
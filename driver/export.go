@@ -0,0 +1,182 @@
+package driver
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/andrewchambers/g/parse"
+	"github.com/andrewchambers/g/resolve"
+	"github.com/andrewchambers/g/util"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// An export data file is a header followed by the export data written by
+// resolve.WriteExportData.
+//
+//	g export 1
+//	source <hash of the package source files>
+//	import <path> <fingerprint of the imported package>
+//	data
+//
+// The fingerprint of a package is the hash of its header. It changes when
+// the package source or anything it imports changes, so export data is
+// stale if its source hash or the fingerprint of any import differs.
+const exportMagic = "g export 1"
+
+// Hash the .g files of a package folder.
+func hashSources(dir string) (string, error) {
+	paths, err := util.GFilesInDir(dir)
+	if err != nil {
+		return "", err
+	}
+	return hashFiles(paths)
+}
+
+func hashFiles(paths []string) (string, error) {
+	paths = append([]string{}, paths...)
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d\n", filepath.Base(path), fi.Size())
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fingerprint(header string) string {
+	return hashBytes([]byte(header))
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// The header of the export data of a package resolved from files, all of
+// its imports have been imported.
+func (imp *importer) exportHeader(sourceHash string, files []*parse.File) string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		for _, s := range f.Imports {
+			if !seen[s.Val] {
+				seen[s.Val] = true
+				paths = append(paths, s.Val)
+			}
+		}
+	}
+	sort.Strings(paths)
+	header := exportMagic + "\n"
+	header += "source " + sourceHash + "\n"
+	imp.mu.Lock()
+	for _, path := range paths {
+		header += "import " + path + " " + imp.fingerprints[path] + "\n"
+	}
+	imp.mu.Unlock()
+	return header
+}
+
+func (imp *importer) exportPath(path string) string {
+	return filepath.Join(imp.exportDir, filepath.FromSlash(path)+".gx")
+}
+
+// Load the export data of a package if it is up to date. Missing, stale
+// or unreadable export data is ignored and the package is compiled from
+// source instead.
+func (imp *importer) loadExportData(path string, sourceHash string) (*resolve.Package, bool) {
+	if imp.exportDir == "" {
+		return nil, false
+	}
+	f, err := os.Open(imp.exportPath(path))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	rd := bufio.NewReader(f)
+	header := ""
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, false
+		}
+		if line == "data\n" {
+			break
+		}
+		header += line
+	}
+	lines := strings.Split(strings.TrimSuffix(header, "\n"), "\n")
+	if len(lines) < 2 || lines[0] != exportMagic || lines[1] != "source "+sourceHash {
+		return nil, false
+	}
+	for _, line := range lines[2:] {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "import" {
+			return nil, false
+		}
+		if _, err := imp.Import(fields[1]); err != nil {
+			return nil, false
+		}
+		imp.mu.Lock()
+		fresh := imp.fingerprints[fields[1]] == fields[2]
+		imp.mu.Unlock()
+		if !fresh {
+			return nil, false
+		}
+	}
+	pkg, err := resolve.ReadExportData(rd, imp)
+	if err != nil || pkg.Path != path {
+		return nil, false
+	}
+	imp.mu.Lock()
+	imp.fingerprints[path] = fingerprint(header)
+	imp.mu.Unlock()
+	return pkg, true
+}
+
+// Write the export data of a package. The file is replaced atomically so
+// concurrent readers never see a partial file.
+func (imp *importer) writeExportData(header string, pkg *resolve.Package) error {
+	path := imp.exportPath(pkg.Path)
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".export")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	w.WriteString(header)
+	w.WriteString("data\n")
+	err = resolve.WriteExportData(w, pkg)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
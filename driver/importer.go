@@ -0,0 +1,474 @@
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/andrewchambers/g/emit"
+	"github.com/andrewchambers/g/parse"
+	"github.com/andrewchambers/g/resolve"
+	"github.com/andrewchambers/g/target"
+	"github.com/andrewchambers/g/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The importer finds imported packages in the directories of a search path,
+// the package with import path "a/b" is the folder a/b of the first search
+// directory containing it. Each package is resolved once however many
+// packages import it. Packages with up to date export data are loaded from
+// it instead of their source.
+//
+// Before the package being compiled is resolved, preload parses everything
+// it imports and resolves independent packages concurrently. mu guards the
+// maps written while doing so.
+type importer struct {
+	machine    target.TargetMachine
+	searchPath []string
+	exportDir  string
+	jobs       int
+
+	mu   sync.Mutex
+	pkgs map[string]*resolve.Package
+	errs map[string]error
+	// Fingerprints of the imported packages, see exportHeader.
+	fingerprints map[string]string
+
+	// Import paths of the packages currently being resolved, the importing
+	// package last.
+	importing []string
+
+	// Packages found and parsed by preload.
+	parsed map[string]*parsedPackage
+	// Packages resolved from source rather than export data.
+	sources map[string]*loadedPackage
+
+	// With a build cache packages compiled before are loaded from their
+	// cached export data.
+	cache        *buildCache
+	emitOpts     emit.Options
+	exportHashes map[string]string
+	cacheKeys    map[string]string
+}
+
+func newImporter(machine target.TargetMachine, opts Options) *importer {
+	return &importer{
+		machine:      machine,
+		searchPath:   opts.SearchPath,
+		exportDir:    opts.ExportDir,
+		jobs:         opts.Jobs,
+		pkgs:         make(map[string]*resolve.Package),
+		errs:         make(map[string]error),
+		fingerprints: make(map[string]string),
+		parsed:       make(map[string]*parsedPackage),
+		sources:      make(map[string]*loadedPackage),
+		emitOpts:     opts.Emit,
+		exportHashes: make(map[string]string),
+		cacheKeys:    make(map[string]string),
+	}
+}
+
+func (imp *importer) Import(path string) (*resolve.Package, error) {
+	if pkg, err, ok := imp.result(path); ok {
+		return pkg, err
+	}
+	// Packages not resolved by preload are resolved here, one at a time.
+	for idx, p := range imp.importing {
+		if p == path {
+			cycle := append(append([]string{}, imp.importing[idx:]...), path)
+			return nil, fmt.Errorf("import cycle not allowed: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	imp.importing = append(imp.importing, path)
+	pkg, err := imp.importPackage(path)
+	imp.importing = imp.importing[:len(imp.importing)-1]
+	imp.setResult(path, pkg, err)
+	return pkg, err
+}
+
+// The result of importing path, ok is false if it has not been imported.
+func (imp *importer) result(path string) (*resolve.Package, error, bool) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	if pkg, ok := imp.pkgs[path]; ok {
+		return pkg, nil, true
+	}
+	if err, ok := imp.errs[path]; ok {
+		return nil, err, true
+	}
+	return nil, nil, false
+}
+
+func (imp *importer) setResult(path string, pkg *resolve.Package, err error) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	if err != nil {
+		imp.errs[path] = err
+	} else {
+		imp.pkgs[path] = pkg
+	}
+}
+
+// A package found and parsed by preload.
+type parsedPackage struct {
+	dir   string
+	files []*parse.File
+	// The error finding or parsing the package.
+	err error
+}
+
+// Find and parse the package, unless preload already has.
+func (imp *importer) parsePackage(path string) (string, []*parse.File, error) {
+	if p, ok := imp.parsed[path]; ok {
+		return p.dir, p.files, p.err
+	}
+	dir, err := imp.findPackage(path)
+	if err != nil {
+		return "", nil, err
+	}
+	files, err := parseFolder(dir, imp.jobs)
+	return dir, files, err
+}
+
+func (imp *importer) importPackage(path string) (*resolve.Package, error) {
+	dir, files, err := imp.parsePackage(path)
+	if dir == "" {
+		return nil, err
+	}
+	sourceHash, herr := hashSources(dir)
+	if herr != nil {
+		return nil, herr
+	}
+	if pkg, ok := imp.loadExportData(path, sourceHash); ok {
+		return pkg, nil
+	}
+	if err != nil {
+		return nil, flattenErrors(err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .g files in %s", dir)
+	}
+	if files[0].Pkg == "main" {
+		return nil, errors.New("cannot import package main")
+	}
+	if pkg, ok := imp.loadCached(path, sourceHash, files); ok {
+		return pkg, nil
+	}
+	r := resolve.New(imp.machine, imp)
+	err = r.ResolvePackage(path, files)
+	if err != nil {
+		return nil, err
+	}
+	header := imp.exportHeader(sourceHash, files)
+	imp.mu.Lock()
+	imp.fingerprints[path] = fingerprint(header)
+	imp.mu.Unlock()
+	pkg := &loadedPackage{
+		path:       path,
+		sourceHash: sourceHash,
+		files:      files,
+		r:          r,
+	}
+	err = imp.prepareCacheEntry(pkg)
+	if err != nil {
+		return nil, err
+	}
+	imp.mu.Lock()
+	imp.sources[path] = pkg
+	imp.mu.Unlock()
+	return r.Package(), nil
+}
+
+// Find and parse every package the files import, directly or not, then
+// resolve them in waves: each wave is the packages whose imports have all
+// been resolved, resolved concurrently. The result of resolving a package
+// only depends on the results for its imports, so it is the same as
+// resolving them one at a time. Packages in import cycles are left to
+// Import, which reports the cycle.
+func (imp *importer) preload(files []*parse.File) {
+	var paths []string
+	frontier := importsOf(files)
+	for len(frontier) != 0 {
+		level := imp.parseLevel(frontier)
+		paths = append(paths, frontier...)
+		frontier = nil
+		for _, path := range level {
+			for _, dep := range importsOf(imp.parsed[path].files) {
+				if _, ok := imp.parsed[dep]; !ok && !contains(frontier, dep) {
+					frontier = append(frontier, dep)
+				}
+			}
+		}
+	}
+
+	for {
+		var wave []string
+		for _, path := range paths {
+			if _, _, done := imp.result(path); done {
+				continue
+			}
+			ready := true
+			for _, dep := range importsOf(imp.parsed[path].files) {
+				if _, _, done := imp.result(dep); !done {
+					ready = false
+				}
+			}
+			if ready {
+				wave = append(wave, path)
+			}
+		}
+		if len(wave) == 0 {
+			return
+		}
+		parallelFor(len(wave), imp.jobs, func(i int) {
+			pkg, err := imp.importPackage(wave[i])
+			imp.setResult(wave[i], pkg, err)
+		})
+	}
+}
+
+// Find the packages with the given import paths and parse all of their
+// files at once. Returns the paths of the packages found.
+func (imp *importer) parseLevel(paths []string) []string {
+	var found []string
+	var filePaths []string
+	var owners []string
+	for _, path := range paths {
+		p := &parsedPackage{}
+		imp.parsed[path] = p
+		p.dir, p.err = imp.findPackage(path)
+		if p.err != nil {
+			continue
+		}
+		var pkgFiles []string
+		pkgFiles, p.err = util.GFilesInDir(p.dir)
+		if p.err != nil {
+			continue
+		}
+		found = append(found, path)
+		for _, f := range pkgFiles {
+			filePaths = append(filePaths, f)
+			owners = append(owners, path)
+		}
+	}
+	files := make([]*parse.File, len(filePaths))
+	errs := make([]error, len(filePaths))
+	parallelFor(len(filePaths), imp.jobs, func(i int) {
+		files[i], errs[i] = ParseFile(filePaths[i])
+	})
+	for _, path := range found {
+		var pkgFiles []*parse.File
+		var pkgErrs []error
+		for i := range filePaths {
+			if owners[i] == path {
+				pkgFiles = append(pkgFiles, files[i])
+				pkgErrs = append(pkgErrs, errs[i])
+			}
+		}
+		p := imp.parsed[path]
+		p.files, p.err = collectParsed(pkgFiles, pkgErrs)
+	}
+	return found
+}
+
+// The import paths of files, each once in order of appearance.
+func importsOf(files []*parse.File) []string {
+	var ret []string
+	for _, f := range files {
+		for _, s := range f.Imports {
+			if !contains(ret, s.Val) {
+				ret = append(ret, s.Val)
+			}
+		}
+	}
+	return ret
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Imported packages in dependency order, every package comes after the
+// packages it imports. The order follows the imports of files, so it does
+// not depend on the order packages were resolved in.
+func (imp *importer) dependencyOrder(files []*parse.File) []string {
+	var order []string
+	visited := make(map[string]bool)
+	var visit func(path string)
+	visit = func(path string) {
+		if visited[path] {
+			return
+		}
+		visited[path] = true
+		if p, ok := imp.sources[path]; ok {
+			for _, dep := range importsOf(p.files) {
+				visit(dep)
+			}
+		} else if p, ok := imp.parsed[path]; ok {
+			for _, dep := range importsOf(p.files) {
+				visit(dep)
+			}
+		}
+		order = append(order, path)
+	}
+	for _, path := range importsOf(files) {
+		visit(path)
+	}
+	return order
+}
+
+// Load a package from the export data in the build cache, if it has been
+// compiled before with the same source and imports.
+func (imp *importer) loadCached(path string, sourceHash string, files []*parse.File) (*resolve.Package, bool) {
+	if imp.cache == nil {
+		return nil, false
+	}
+	importHashes, ok := imp.importHashes(files)
+	if !ok {
+		return nil, false
+	}
+	key := cacheKey(imp.machine, imp.emitOpts, path, sourceHash, importHashes)
+	if _, ok := imp.cache.get(key, cacheObject); !ok {
+		return nil, false
+	}
+	exportPath, ok := imp.cache.get(key, cacheExport)
+	if !ok {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(exportPath)
+	if err != nil {
+		return nil, false
+	}
+	pkg, err := resolve.ReadExportData(bytes.NewReader(data), imp)
+	if err != nil || pkg.Path != path {
+		return nil, false
+	}
+	imp.mu.Lock()
+	imp.cacheKeys[path] = key
+	imp.exportHashes[path] = hashBytes(data)
+	imp.mu.Unlock()
+	return pkg, true
+}
+
+// Compute the cache key and export data of a package resolved from source,
+// they are stored in the cache once the package is compiled.
+func (imp *importer) prepareCacheEntry(pkg *loadedPackage) error {
+	if imp.cache == nil {
+		return nil
+	}
+	importHashes, ok := imp.importHashes(pkg.files)
+	if !ok {
+		return fmt.Errorf("no export data hash for an import of %s", pkg.path)
+	}
+	pkg.cacheKey = cacheKey(imp.machine, imp.emitOpts, pkg.path, pkg.sourceHash, importHashes)
+	if pkg.path == "main" {
+		return nil
+	}
+	var buf bytes.Buffer
+	err := resolve.WriteExportData(&buf, pkg.r.Package())
+	if err != nil {
+		return err
+	}
+	pkg.exportData = buf.Bytes()
+	imp.mu.Lock()
+	imp.exportHashes[pkg.path] = hashBytes(pkg.exportData)
+	imp.mu.Unlock()
+	return nil
+}
+
+// The hashes of the export data of the packages files import, false if
+// any of them fails to import.
+func (imp *importer) importHashes(files []*parse.File) (map[string]string, bool) {
+	ret := make(map[string]string)
+	for _, f := range files {
+		for _, s := range f.Imports {
+			if _, err := imp.Import(s.Val); err != nil {
+				return nil, false
+			}
+			imp.mu.Lock()
+			ret[s.Val] = imp.exportHashes[s.Val]
+			imp.mu.Unlock()
+		}
+	}
+	return ret, true
+}
+
+func (imp *importer) findPackage(path string) (string, error) {
+	if filepath.IsAbs(path) || strings.HasPrefix(path, ".") || strings.ContainsAny(path, "\\ \t\n") {
+		return "", fmt.Errorf("invalid import path %q", path)
+	}
+	for _, dir := range imp.searchPath {
+		pkgDir := filepath.Join(dir, filepath.FromSlash(path))
+		if isDir, err := util.IsDirectory(pkgDir); err == nil && isDir {
+			return pkgDir, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find package %q in any of: %s", path, strings.Join(imp.searchPath, ", "))
+}
+
+// The import path of the package in dir, the path relative to the search
+// directory containing it. Packages outside the search path are known
+// by their name.
+func (imp *importer) importPathOf(dir string, name string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return name
+	}
+	for _, sdir := range imp.searchPath {
+		sabs, err := filepath.Abs(sdir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(sabs, abs)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			continue
+		}
+		return filepath.ToSlash(rel)
+	}
+	return name
+}
+
+// Parse errors of a folder are one error per file, merge the syntax errors
+// into one sorted DiagnosticList so they are reported like type errors.
+func flattenErrors(err error) error {
+	errs, ok := err.(util.ErrorList)
+	if !ok {
+		return err
+	}
+	var diags parse.DiagnosticList
+	for _, e := range errs {
+		l, ok := e.(parse.DiagnosticList)
+		if !ok {
+			return err
+		}
+		diags = append(diags, l...)
+	}
+	diags.Sort()
+	return diags
+}
+
+// A package imported by several packages reports its problems to each of
+// them, keep the first report of each diagnostic.
+func dedupDiagnostics(err error) error {
+	diags, ok := err.(parse.DiagnosticList)
+	if !ok {
+		return err
+	}
+	seen := make(map[*parse.Diagnostic]bool)
+	var ret parse.DiagnosticList
+	for _, d := range diags {
+		if !seen[d] {
+			seen[d] = true
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
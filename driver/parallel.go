@@ -0,0 +1,52 @@
+package driver
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Run f(0) to f(n-1) on up to jobs goroutines, jobs <= 0 means one per CPU.
+// Callers store results by index, so they do not depend on scheduling.
+// A panic in f is raised again in the caller once every call has finished,
+// the panic of the lowest index wins.
+func parallelFor(n, jobs int, f func(i int)) {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs > n {
+		jobs = n
+	}
+	if jobs <= 1 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+	panics := make([]interface{}, n)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				func() {
+					defer func() {
+						panics[i] = recover()
+					}()
+					f(i)
+				}()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, v := range panics {
+		if v != nil {
+			panic(v)
+		}
+	}
+}
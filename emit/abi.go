@@ -0,0 +1,268 @@
+package emit
+
+import (
+	"fmt"
+	"github.com/andrewchambers/g/resolve"
+	"strings"
+)
+
+// Unions are passed to and returned from functions the way the C ABI of
+// the target passes a C union with the same layout, so functions taking or
+// returning unions by value can be shared with C. Other values are passed
+// as their LLVM type.
+//
+// On x86-64 System V a union larger than 16 bytes is passed in memory, as
+// a byval argument, or returned through a hidden sret pointer passed before
+// the other arguments. A smaller union is split into eightbytes, each
+// passed in an integer register if any member has an integer in it and in
+// an SSE register otherwise. On 32 bit x86 unions are passed on the stack,
+// and returned in registers only when their size is 1, 2, 4 or 8.
+
+type abiClass int
+
+const (
+	// Passed as its LLVM type.
+	abiDirect abiClass = iota
+	// Passed as the pieces of another LLVM type covering the same memory.
+	abiCoerced
+	// Passed in memory.
+	abiIndirect
+)
+
+type abiInfo struct {
+	class abiClass
+	// The LLVM types of the pieces of a coerced value.
+	pieces []string
+}
+
+// The LLVM type a coerced value is stored as to split it into pieces.
+func (info abiInfo) coercedType() string {
+	if len(info.pieces) == 1 {
+		return info.pieces[0]
+	}
+	return "{ " + strings.Join(info.pieces, ", ") + " }"
+}
+
+// How a value of type t is passed as an argument, or returned if isResult.
+func (e *emitter) classify(t resolve.GType, isResult bool) abiInfo {
+	if _, ok := underlying(t).(*resolve.GUnion); !ok {
+		return abiInfo{class: abiDirect}
+	}
+	size := resolve.SizeOf(e.machine, t)
+	switch {
+	case size == 0:
+		// Empty unions are not C, but like empty structs they take no
+		// registers.
+		return abiInfo{class: abiDirect}
+	case strings.HasPrefix(e.machine.LLVMTargetTriple(), "x86_64"):
+		if size > 16 {
+			return abiInfo{class: abiIndirect}
+		}
+		return abiInfo{abiCoerced, e.sysVPieces(t, size)}
+	case isResult && (size == 1 || size == 2 || size == 4 || size == 8):
+		return abiInfo{abiCoerced, []string{fmt.Sprintf("i%d", size*8)}}
+	}
+	return abiInfo{class: abiIndirect}
+}
+
+// What the scalars overlapping an eightbyte of a value are.
+type eightbyte struct {
+	integer bool
+	float   bool
+	double  bool
+}
+
+// The register sized pieces of a value of at most 16 bytes, an integer for
+// each eightbyte holding an integer, otherwise a float, two floats or a
+// double.
+func (e *emitter) sysVPieces(t resolve.GType, size uint64) []string {
+	words := make([]eightbyte, (size+7)/8)
+	e.classifyScalars(t, 0, words)
+	var pieces []string
+	for idx, w := range words {
+		n := size - uint64(idx)*8
+		if n > 8 {
+			n = 8
+		}
+		switch {
+		case w.integer || !w.float:
+			pieces = append(pieces, fmt.Sprintf("i%d", n*8))
+		case w.double:
+			pieces = append(pieces, "double")
+		case n <= 4:
+			pieces = append(pieces, "float")
+		default:
+			pieces = append(pieces, "<2 x float>")
+		}
+	}
+	return pieces
+}
+
+// Record the scalars of a value of type t at offset in the eightbytes
+// they overlap.
+func (e *emitter) classifyScalars(t resolve.GType, offset uint64, words []eightbyte) {
+	switch t := underlying(t).(type) {
+	case *resolve.GFloat:
+		words[offset/8].float = true
+		if t.Bits == 64 {
+			words[offset/8].double = true
+		}
+	case *resolve.GStruct:
+		for idx, sub := range t.Types {
+			e.classifyScalars(sub, offset+resolve.FieldOffset(e.machine, t, idx), words)
+		}
+	case *resolve.GTuple:
+		e.classifyScalars(&resolve.GStruct{Types: t.Types}, offset, words)
+	case *resolve.GArray:
+		elemSize := resolve.SizeOf(e.machine, t.SubType)
+		for idx := uint64(0); idx < uint64(t.Dim); idx++ {
+			e.classifyScalars(t.SubType, offset+idx*elemSize, words)
+		}
+	case *resolve.GUnion:
+		for _, sub := range t.Types {
+			e.classifyScalars(sub, offset, words)
+		}
+	case *resolve.GTaggedUnion:
+		e.classifyScalars(t.TagType(), offset, words)
+		payload, _, _ := resolve.TaggedUnionPayload(e.machine, t)
+		for _, sub := range t.Types {
+			e.classifyScalars(sub, offset+payload, words)
+		}
+	default:
+		// Integers, enums and pointers.
+		words[offset/8].integer = true
+	}
+}
+
+// The alignment of the stack copy of a byval argument.
+func (e *emitter) byvalAlign(t resolve.GType) uint64 {
+	align := uint64(e.machine.PointerBitWidth() / 8)
+	if a := resolve.AlignOf(e.machine, t); a > align {
+		align = a
+	}
+	return align
+}
+
+// A pointer parameter to a value of type t passed in memory, with the
+// byval or sret attribute it needs if attrs is set.
+func (e *emitter) indirectParam(t resolve.GType, attr string, attrs bool) string {
+	llty := e.gTypeToLLVM(t)
+	switch {
+	case !attrs:
+		return llty + "*"
+	case attr == "byval":
+		return fmt.Sprintf("%s* byval(%s) align %d", llty, llty, e.byvalAlign(t))
+	}
+	return fmt.Sprintf("%s* %s(%s)", llty, attr, llty)
+}
+
+// The LLVM result type and parameter types of functions of type ft. With
+// attrs the parameters carry the attributes declarations and calls need.
+//
+// Functions with multiple results return void and write each result
+// through a hidden pointer argument passed before the real arguments.
+// This keeps them callable from C.
+func (e *emitter) lowerSignature(ft *resolve.GFunc, attrs bool) (string, []string) {
+	ret := "void"
+	var params []string
+	if tt, ok := underlying(ft.RetType).(*resolve.GTuple); ok {
+		for _, gty := range tt.Types {
+			params = append(params, e.gTypeToLLVM(gty)+"*")
+		}
+	} else {
+		switch info := e.classify(ft.RetType, true); info.class {
+		case abiDirect:
+			ret = e.gTypeToLLVM(ft.RetType)
+		case abiCoerced:
+			ret = info.coercedType()
+		case abiIndirect:
+			params = append(params, e.indirectParam(ft.RetType, "sret", attrs))
+		}
+	}
+	for _, gty := range ft.ArgTypes {
+		switch info := e.classify(gty, false); info.class {
+		case abiDirect:
+			params = append(params, e.gTypeToLLVM(gty))
+		case abiCoerced:
+			params = append(params, info.pieces...)
+		case abiIndirect:
+			params = append(params, e.indirectParam(gty, "byval", attrs))
+		}
+	}
+	return ret, params
+}
+
+// A stack slot for a value of type t which is also large enough to hold
+// its coerced type. Returns the slot as a pointer to the coerced type and
+// as a pointer to t.
+func (e *emitter) emitCoercedSlot(t resolve.GType, info abiInfo) (string, string) {
+	align := resolve.AlignOf(e.machine, t)
+	if align < 8 {
+		align = 8
+	}
+	mem := e.newLLVMName()
+	fmt.Fprintf(&e.allocas, "    %s = alloca %s, align %d\n", mem, info.coercedType(), align)
+	slot := e.newLLVMName()
+	fmt.Fprintf(&e.allocas, "    %s = bitcast %s* %s to %s*\n", slot, info.coercedType(), mem, e.gTypeToLLVM(t))
+	return mem, slot
+}
+
+func (e *emitter) emitLoadCoerced(mem string, info abiInfo) string {
+	ct := info.coercedType()
+	ret := e.newLLVMName()
+	e.emiti("%s = load %s, %s* %s\n", ret, ct, ct, mem)
+	return ret
+}
+
+// Split a coerced value into its pieces.
+func (e *emitter) emitSplitCoerced(v string, info abiInfo) []string {
+	if len(info.pieces) == 1 {
+		return []string{v}
+	}
+	var ret []string
+	for idx := range info.pieces {
+		name := e.newLLVMName()
+		e.emiti("%s = extractvalue %s %s, %d\n", name, info.coercedType(), v, idx)
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// Join the pieces of a coerced value and store it into mem.
+func (e *emitter) emitStorePieces(mem string, info abiInfo, pieces []string) {
+	ct := info.coercedType()
+	v := pieces[0]
+	if len(pieces) != 1 {
+		v = "undef"
+		for idx, p := range pieces {
+			name := e.newLLVMName()
+			e.emiti("%s = insertvalue %s %s, %s %s, %d\n", name, ct, v, info.pieces[idx], p, idx)
+			v = name
+		}
+	}
+	e.emiti("store %s %s, %s* %s\n", ct, v, ct, mem)
+}
+
+// The call arguments passing v the way the C ABI passes its type.
+func (e *emitter) emitLowerArg(v Value) []string {
+	t := v.getGType()
+	llty := e.gTypeToLLVM(t)
+	switch info := e.classify(t, false); info.class {
+	case abiCoerced:
+		mem, slot := e.emitCoercedSlot(t, info)
+		e.emitStore(slot, v)
+		var ret []string
+		for idx, p := range e.emitSplitCoerced(e.emitLoadCoerced(mem, info), info) {
+			ret = append(ret, info.pieces[idx]+" "+p)
+		}
+		return ret
+	case abiIndirect:
+		// The callee gets its own copy of the memory.
+		align := e.byvalAlign(t)
+		tmp := e.newLLVMName()
+		fmt.Fprintf(&e.allocas, "    %s = alloca %s, align %d\n", tmp, llty, align)
+		e.emitStore(tmp, v)
+		return []string{fmt.Sprintf("%s* byval(%s) align %d %s", llty, llty, align, tmp)}
+	}
+	return []string{llty + " " + v.getLLVMRepr()}
+}
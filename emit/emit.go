@@ -2,13 +2,1619 @@ package emit
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
 	"github.com/andrewchambers/g/parse"
 	"github.com/andrewchambers/g/resolve"
 	"github.com/andrewchambers/g/target"
+	"math"
+	"math/big"
+	"strings"
 )
 
-func EmitModule(machine target.TargetMachine, out *bufio.Writer, files []*parse.File) error {
-	r := resolve.New()
-	r.ResolvePackage(files)
-	return nil
+// The emitter walks a type checked package and writes LLVM text.
+// All user facing errors are reported by the resolver, so any inconsistency
+// found while emitting is an internal error.
+
+type emitter struct {
+	machine target.TargetMachine
+
+	out *bufio.Writer
+	// Module level definitions are buffered, named types are only known
+	// once everything using them has been emitted and must come first.
+	module bytes.Buffer
+
+	llvmNameCounter  uint
+	llvmLabelCounter uint
+	curFuncType      *resolve.GFunc
+
+	r *resolve.Resolver
+
+	// Allocas are hoisted into the entry block of the current function,
+	// the rest of the function body is buffered separately.
+	allocas bytes.Buffer
+	body    bytes.Buffer
+
+	// Stack slots of locals in the current function.
+	slots map[resolve.Symbol]string
+
+	// Targets of break and continue for the enclosing statements.
+	breakTargets    []jumpTarget
+	continueTargets []jumpTarget
+
+	// Deferred blocks of each enclosing scope, innermost last.
+	deferScopes [][]*parse.Defer
+
+	// Has the current basic block been terminated by
+	// a branch or return?
+	isCurBlockTerminated bool
+
+	// String literals are emitted once per package after the functions,
+	// identical literals share a global.
+	stringGlobals map[string]string
+	stringOrder   []string
+
+	// Named aggregate types needing a type definition, in order of first use.
+	namedTypes     map[*resolve.GNamedType]bool
+	namedTypeOrder []*resolve.GNamedType
+
+	// Functions and globals of imported packages needing a declaration.
+	externs     map[resolve.Symbol]bool
+	externOrder []resolve.Symbol
+
+	opts Options
+	// Is the allocator called and in need of a declaration?
+	usesAllocator bool
+}
+
+// Options control code generation.
+type Options struct {
+	// The function called by new, it has the signature of C calloc and
+	// must return zeroed memory. Empty means calloc.
+	Allocator string
+}
+
+func (o Options) allocator() string {
+	if o.Allocator == "" {
+		return "calloc"
+	}
+	return o.Allocator
+}
+
+// A jump must first run the defers of every scope it leaves,
+// depth is the number of scopes outside the target.
+type jumpTarget struct {
+	label string
+	depth int
+}
+
+type Value interface {
+	getLLVMRepr() string
+	isLVal() bool
+	getGType() resolve.GType
+}
+
+type exprValue struct {
+	llvmName string
+	lval     bool
+	gType    resolve.GType
+}
+
+var builtinBoolGType resolve.GType = &resolve.GInt{Bits: 1, Signed: false}
+var builtinIndexGType resolve.GType = &resolve.GInt{Bits: 64, Signed: true}
+
+func (v *exprValue) getLLVMRepr() string {
+	return v.llvmName
+}
+
+func (v *exprValue) isLVal() bool {
+	return v.lval
+}
+
+func (v *exprValue) getGType() resolve.GType {
+	return v.gType
+}
+
+func newEmitter(m target.TargetMachine, opts Options, out *bufio.Writer, r *resolve.Resolver) *emitter {
+	ret := &emitter{}
+	ret.machine = m
+	ret.opts = opts
+	ret.out = out
+	ret.r = r
+	ret.stringGlobals = make(map[string]string)
+	ret.namedTypes = make(map[*resolve.GNamedType]bool)
+	ret.externs = make(map[resolve.Symbol]bool)
+	return ret
+}
+
+func (e *emitter) newLLVMLabel() string {
+	ret := fmt.Sprintf(".L%d", e.llvmLabelCounter)
+	e.llvmLabelCounter++
+	return ret
+}
+
+func (e *emitter) newLLVMName() string {
+	ret := fmt.Sprintf("%%.%d", e.llvmNameCounter)
+	e.llvmNameCounter++
+	return ret
+}
+
+// Emit at module level.
+func (e *emitter) emit(s string, args ...interface{}) {
+	fmt.Fprintf(&e.module, s, args...)
+}
+
+// Emit an instruction into the current function.
+func (e *emitter) emiti(s string, args ...interface{}) {
+	if e.isCurBlockTerminated {
+		// Dead code still needs a basic block.
+		e.emitl(e.newLLVMLabel())
+	}
+	fmt.Fprintf(&e.body, "    "+s, args...)
+}
+
+// Emit an instruction which ends the current basic block.
+func (e *emitter) emitTerminator(s string, args ...interface{}) {
+	e.emiti(s, args...)
+	e.isCurBlockTerminated = true
+}
+
+// Emit a label starting a new basic block, falling through from the previous block.
+func (e *emitter) emitl(l string) {
+	if !e.isCurBlockTerminated {
+		fmt.Fprintf(&e.body, "    br label %%%s\n", l)
+	}
+	e.isCurBlockTerminated = false
+	fmt.Fprintf(&e.body, "  %s:\n", l)
+}
+
+func (e *emitter) emitAlloca(t resolve.GType) string {
+	name := e.newLLVMName()
+	fmt.Fprintf(&e.allocas, "    %s = alloca %s\n", name, e.gTypeToLLVM(t))
+	return name
+}
+
+// Emit a package already resolved by r.
+func EmitModule(machine target.TargetMachine, opts Options, out *bufio.Writer, r *resolve.Resolver, files []*parse.File) error {
+	e := newEmitter(machine, opts, out, r)
+
+	for _, t := range r.NamedTypes() {
+		e.useNamedType(t)
+	}
+
+	for _, f := range files {
+		for _, vd := range f.VarDecls {
+			e.emitGlobalVarDecl(vd)
+		}
+	}
+	e.emit("\n")
+
+	for _, f := range files {
+		for _, fd := range f.FuncDecls {
+			e.llvmLabelCounter = 0
+			e.llvmNameCounter = 0
+			e.emitFuncDecl(fd)
+		}
+	}
+	e.emitStringGlobals()
+	if e.usesAllocator {
+		size := e.sizeTypeToLLVM()
+		e.emit("\ndeclare i8* @%s(%s, %s)\n", e.opts.allocator(), size, size)
+	}
+	e.emitExterns()
+
+	body := e.module.Bytes()
+	e.module = bytes.Buffer{}
+	e.emitPrelude()
+	// Type definitions can use further named types, the list grows
+	// until every one is defined.
+	for idx := 0; idx < len(e.namedTypeOrder); idx++ {
+		e.emitNamedType(e.namedTypeOrder[idx])
+	}
+	e.emit("\n")
+	out.Write(e.module.Bytes())
+	out.Write(body)
+	return out.Flush()
+}
+
+// Symbols of package main keep their names, other packages prefix them with
+// their import path so equal names in different packages do not clash.
+func linkName(pkg, name string) string {
+	if pkg != "" {
+		name = pkg + "." + name
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-$._", c)) {
+			// LLVM accepts any name in quotes.
+			return fmt.Sprintf("\"%s\"", name)
+		}
+	}
+	return name
+}
+
+func (e *emitter) useNamedType(t *resolve.GNamedType) {
+	if !e.namedTypes[t] {
+		e.namedTypes[t] = true
+		e.namedTypeOrder = append(e.namedTypeOrder, t)
+	}
+}
+
+func (e *emitter) useExtern(s resolve.Symbol) {
+	if !e.externs[s] {
+		e.externs[s] = true
+		e.externOrder = append(e.externOrder, s)
+	}
+}
+
+// Declare the functions and globals used from imported packages.
+func (e *emitter) emitExterns() {
+	if len(e.externOrder) != 0 {
+		e.emit("\n")
+	}
+	for _, s := range e.externOrder {
+		switch s := s.(type) {
+		case *resolve.FuncSymbol:
+			ret, params := e.lowerSignature(s.Type, true)
+			e.emit("declare %s @%s(%s)\n", ret, linkName(s.Pkg, s.Name), strings.Join(params, ", "))
+		case *resolve.GlobalSymbol:
+			e.emit("@%s = external global %s\n", linkName(s.Pkg, s.Name), e.gTypeToLLVM(s.Type))
+		default:
+			panic("internal error")
+		}
+	}
+}
+
+// The LLVM type of C size_t.
+func (e *emitter) sizeTypeToLLVM() string {
+	return fmt.Sprintf("i%d", e.machine.PointerBitWidth())
+}
+
+// new T calls the allocator for one zeroed T.
+func (e *emitter) emitNew(n *parse.New) Value {
+	return e.emitAllocate(e.r.TypeOf(n))
+}
+
+// Call the allocator for the zeroed memory a pointer of type t points to.
+func (e *emitter) emitAllocate(t resolve.GType) Value {
+	e.usesAllocator = true
+	size := resolve.SizeOf(e.machine, t.(*resolve.GPointer).PointsTo)
+	sizety := e.sizeTypeToLLVM()
+	mem := e.newLLVMName()
+	e.emiti("%s = call i8* @%s(%s 1, %s %d)\n", mem, e.opts.allocator(), sizety, sizety, size)
+	ret := &exprValue{e.newLLVMName(), false, t}
+	e.emiti("%s = bitcast i8* %s to %s\n", ret.llvmName, mem, e.gTypeToLLVM(t))
+	return ret
+}
+
+// Returns a constant pointer to the first char of a NUL terminated
+// global holding s.
+func (e *emitter) stringToLLVM(s string) string {
+	name, ok := e.stringGlobals[s]
+	if !ok {
+		name = fmt.Sprintf("@.str.%d", len(e.stringOrder))
+		e.stringGlobals[s] = name
+		e.stringOrder = append(e.stringOrder, s)
+	}
+	arrty := fmt.Sprintf("[%d x i8]", len(s)+1)
+	return fmt.Sprintf("getelementptr inbounds (%s, %s* %s, i64 0, i64 0)", arrty, arrty, name)
+}
+
+func (e *emitter) emitStringGlobals() {
+	if len(e.stringOrder) != 0 {
+		e.emit("\n")
+	}
+	for _, s := range e.stringOrder {
+		var buff bytes.Buffer
+		for _, b := range []byte(s + "\x00") {
+			if b < ' ' || b > '~' || b == '"' || b == '\\' {
+				fmt.Fprintf(&buff, "\\%02X", b)
+			} else {
+				buff.WriteByte(b)
+			}
+		}
+		e.emit("%s = private unnamed_addr constant [%d x i8] c\"%s\"\n", e.stringGlobals[s], len(s)+1, buff.String())
+	}
+}
+
+func (e *emitter) emitPrelude() {
+	e.emit("target triple = \"%s\"\n\n", e.machine.LLVMTargetTriple())
+}
+
+func (e *emitter) emitNamedType(t *resolve.GNamedType) {
+	switch ty := t.Type.(type) {
+	case *resolve.GStruct:
+		e.emit("%%%s = type %s\n", linkName(t.Pkg, t.Name), e.structToLLVM(ty))
+	case *resolve.GUnion:
+		e.emit("%%%s = type %s\n", linkName(t.Pkg, t.Name), e.unionToLLVM(ty))
+	case *resolve.GTaggedUnion:
+		e.emit("%%%s = type %s\n", linkName(t.Pkg, t.Name), e.taggedUnionToLLVM(ty))
+	default:
+		// Only aggregates have distinct LLVM types, other named types are
+		// just their underlying type.
+	}
+}
+
+func (e *emitter) emitGlobalVarDecl(vd *parse.VarDecl) {
+	gs := e.r.Lookup(vd).(*resolve.GlobalSymbol)
+	init := "zeroinitializer"
+	if vd.Init != nil {
+		init = e.globalInitToLLVM(vd.Init.R)
+	}
+	e.emit("@%s = global %s %s\n", linkName(gs.Pkg, vd.Name), e.gTypeToLLVM(gs.Type), init)
+}
+
+// Global initializers are constants or composite literals of constants,
+// which become LLVM constant aggregates.
+func (e *emitter) globalInitToLLVM(n parse.Node) string {
+	if s, ok := n.(*parse.String); ok {
+		return e.stringToLLVM(s.Val)
+	}
+	if tup, ok := n.(*parse.Tuple); ok {
+		tt := underlying(e.r.TypeOf(tup)).(*resolve.GTuple)
+		var vals []string
+		for idx, elem := range tup.Elems {
+			vals = append(vals, e.gTypeToLLVM(tt.Types[idx])+" "+e.globalInitToLLVM(elem))
+		}
+		return "{ " + strings.Join(vals, ", ") + " }"
+	}
+	lit, ok := n.(*parse.Initializer)
+	if !ok {
+		v, ok := e.r.ConstantValue(n)
+		if !ok {
+			panic("internal error")
+		}
+		return constantToLLVM(v)
+	}
+	var types []resolve.GType
+	_, isArray := underlying(e.r.TypeOf(lit)).(*resolve.GArray)
+	switch t := underlying(e.r.TypeOf(lit)).(type) {
+	case *resolve.GStruct:
+		types = t.Types
+	case *resolve.GArray:
+		for idx := uint(0); idx < t.Dim; idx++ {
+			types = append(types, t.SubType)
+		}
+	}
+	vals := make([]string, len(types))
+	for idx := range vals {
+		vals[idx] = "zeroinitializer"
+	}
+	for pos, sub := range lit.Sub {
+		idx, sub := e.literalElem(lit, pos, sub)
+		vals[idx] = e.globalInitToLLVM(sub)
+	}
+	for idx := range vals {
+		vals[idx] = e.gTypeToLLVM(types[idx]) + " " + vals[idx]
+	}
+	if isArray {
+		return "[" + strings.Join(vals, ", ") + "]"
+	}
+	return "{ " + strings.Join(vals, ", ") + " }"
+}
+
+// Returns the index a composite literal element initializes, and its value.
+func (e *emitter) literalElem(lit *parse.Initializer, pos int, sub parse.Node) (int, parse.Node) {
+	kv, ok := sub.(*parse.KeyValue)
+	if !ok {
+		return pos, sub
+	}
+	st := underlying(e.r.TypeOf(lit)).(*resolve.GStruct)
+	return st.FieldIndex(kv.Key.Val), kv.Val
+}
+
+func (e *emitter) emitFuncDecl(f *parse.FuncDecl) {
+	fs := e.r.Lookup(f).(*resolve.FuncSymbol)
+	ft := fs.Type
+	e.curFuncType = ft
+	e.slots = make(map[resolve.Symbol]string)
+	e.allocas.Reset()
+	e.body.Reset()
+	e.isCurBlockTerminated = false
+
+	ret, params := e.lowerSignature(ft, true)
+	names := e.handleFuncPrologue(f)
+	for idx := range params {
+		params[idx] += " " + names[idx]
+	}
+	e.emitBlock(f.Body)
+	if !e.isCurBlockTerminated {
+		if isVoid(ft.RetType) {
+			e.emitTerminator("ret void\n")
+		} else {
+			// The type checker reports a missing return, so the end of
+			// a function with a result cannot be reached.
+			e.emitTerminator("unreachable\n")
+		}
+	}
+	e.emit("define %s @%s(%s) {\n", ret, linkName(fs.Pkg, f.Name), strings.Join(params, ", "))
+	e.emit("  .entry:\n")
+	e.module.Write(e.allocas.Bytes())
+	e.module.Write(e.body.Bytes())
+	e.emit("}\n\n")
+}
+
+// Spill the arguments to the stack so they can be treated like locals.
+// Returns the names of the parameters, in the order of lowerSignature.
+func (e *emitter) handleFuncPrologue(fd *parse.FuncDecl) []string {
+	ft := e.curFuncType
+	var names []string
+	if tt, ok := underlying(ft.RetType).(*resolve.GTuple); ok {
+		for idx := range tt.Types {
+			names = append(names, fmt.Sprintf("%%.ret%d", idx))
+		}
+	} else if e.classify(ft.RetType, true).class == abiIndirect {
+		names = append(names, "%.sret")
+	}
+	for idx := range fd.ArgNames {
+		gty := ft.ArgTypes[idx]
+		llty := e.gTypeToLLVM(gty)
+		switch info := e.classify(gty, false); info.class {
+		case abiDirect:
+			names = append(names, fmt.Sprintf("%%.arg%d", idx))
+			fmt.Fprintf(&e.allocas, "    %%.arg%d.addr = alloca %s\n", idx, llty)
+			e.emiti("store %s %%.arg%d, %s* %%.arg%d.addr\n", llty, idx, llty, idx)
+		case abiCoerced:
+			var pieces []string
+			for p := range info.pieces {
+				pieces = append(pieces, fmt.Sprintf("%%.arg%d.%d", idx, p))
+			}
+			names = append(names, pieces...)
+			mem, slot := e.emitCoercedSlot(gty, info)
+			fmt.Fprintf(&e.allocas, "    %%.arg%d.addr = bitcast %s* %s to %s*\n", idx, llty, slot, llty)
+			e.emitStorePieces(mem, info, pieces)
+		case abiIndirect:
+			// The memory of a byval argument belongs to the callee.
+			names = append(names, fmt.Sprintf("%%.arg%d", idx))
+			fmt.Fprintf(&e.allocas, "    %%.arg%d.addr = bitcast %s* %%.arg%d to %s*\n", idx, llty, idx, llty)
+		}
+	}
+	return names
+}
+
+func (e *emitter) emitStatement(stmt parse.Node) {
+	switch stmt := stmt.(type) {
+	case *parse.VarDecl:
+		e.emitLocalVarDecl(stmt)
+	case *parse.MultiVarDecl:
+		e.emitMultiVarDecl(stmt)
+	case *parse.Assign:
+		e.emitAssign(stmt)
+	case *parse.Return:
+		e.emitReturn(stmt)
+	case *parse.If:
+		e.emitIf(stmt)
+	case *parse.For:
+		e.emitFor(stmt)
+	case *parse.Switch:
+		e.emitSwitch(stmt)
+	case *parse.Match:
+		e.emitMatch(stmt)
+	case *parse.Break:
+		e.emitJump(e.breakTargets[len(e.breakTargets)-1])
+	case *parse.Continue:
+		e.emitJump(e.continueTargets[len(e.continueTargets)-1])
+	case *parse.Defer:
+		top := len(e.deferScopes) - 1
+		e.deferScopes[top] = append(e.deferScopes[top], stmt)
+	case *parse.EmptyStatement:
+	case *parse.ExpressionStatement:
+		e.emitExpression(stmt.Expr)
+	default:
+		panic(stmt)
+	}
+}
+
+// Emit a list of statements in a new scope, running its defers
+// if control falls off the end.
+func (e *emitter) emitBlock(stmts []parse.Node) {
+	e.deferScopes = append(e.deferScopes, nil)
+	for _, stmt := range stmts {
+		e.emitStatement(stmt)
+	}
+	if !e.isCurBlockTerminated {
+		e.emitDefers(len(e.deferScopes) - 1)
+	}
+	e.deferScopes = e.deferScopes[:len(e.deferScopes)-1]
+}
+
+// Emit the pending defers of all scopes deeper than depth, innermost first.
+// Each exit path gets its own copy of the deferred code.
+func (e *emitter) emitDefers(depth int) {
+	for scope := len(e.deferScopes) - 1; scope >= depth; scope-- {
+		defers := e.deferScopes[scope]
+		for idx := len(defers) - 1; idx >= 0; idx-- {
+			e.emitBlock(defers[idx].Body)
+		}
+	}
+}
+
+func (e *emitter) emitJump(t jumpTarget) {
+	e.emitDefers(t.depth)
+	e.emitTerminator("br label %%%s\n", t.label)
+}
+
+func (e *emitter) pushBreakTarget(label string) {
+	e.breakTargets = append(e.breakTargets, jumpTarget{label, len(e.deferScopes)})
+}
+
+func (e *emitter) popBreakTarget() {
+	e.breakTargets = e.breakTargets[:len(e.breakTargets)-1]
+}
+
+func (e *emitter) emitLocalVarDecl(vd *parse.VarDecl) {
+	sym := e.r.Lookup(vd).(*resolve.LocalSymbol)
+	slot, ok := e.slots[sym]
+	if !ok {
+		slot = e.emitAlloca(sym.Type)
+		e.slots[sym] = slot
+	}
+	if vd.Init != nil {
+		e.emitAssign(vd.Init)
+		return
+	}
+	e.emitZeroMem(slot, sym.Type)
+}
+
+func (e *emitter) emitMultiVarDecl(m *parse.MultiVarDecl) {
+	for _, vd := range m.Decls {
+		sym := e.r.Lookup(vd).(*resolve.LocalSymbol)
+		slot, ok := e.slots[sym]
+		if !ok {
+			slot = e.emitAlloca(sym.Type)
+			e.slots[sym] = slot
+		}
+		if m.Init == nil {
+			e.emitZeroMem(slot, sym.Type)
+		}
+	}
+	if m.Init != nil {
+		e.emitAssign(m.Init)
+	}
+}
+
+// Evaluate a bool expression as an i1 suitable for a conditional branch.
+func (e *emitter) emitCondition(n parse.Node) Value {
+	return e.emitRValue(e.emitExpression(n))
+}
+
+func (e *emitter) emitIf(i *parse.If) {
+	v := e.emitCondition(i.Cond)
+	iftrue := e.newLLVMLabel()
+	iffalse := e.newLLVMLabel()
+	after := e.newLLVMLabel()
+
+	e.emitTerminator("br i1 %s, label %%%s, label %%%s\n", v.getLLVMRepr(), iftrue, iffalse)
+	e.emitl(iftrue)
+	e.emitBlock(i.Body)
+	if !e.isCurBlockTerminated {
+		e.emitTerminator("br label %%%s\n", after)
+	}
+	e.emitl(iffalse)
+	e.emitBlock(i.Els)
+	e.emitl(after)
+}
+
+func (e *emitter) emitFor(f *parse.For) {
+	if f.Init != nil {
+		e.emitStatement(f.Init)
+	}
+
+	loopbegin := e.newLLVMLabel()
+	loopbody := e.newLLVMLabel()
+	loopstep := e.newLLVMLabel()
+	loopexit := e.newLLVMLabel()
+
+	e.emitl(loopbegin)
+
+	if f.Cond != nil {
+		v := e.emitCondition(f.Cond)
+		e.emitTerminator("br i1 %s, label %%%s, label %%%s\n", v.getLLVMRepr(), loopbody, loopexit)
+	}
+	e.emitl(loopbody)
+	e.pushBreakTarget(loopexit)
+	e.continueTargets = append(e.continueTargets, jumpTarget{loopstep, len(e.deferScopes)})
+	e.emitBlock(f.Body)
+	e.popBreakTarget()
+	e.continueTargets = e.continueTargets[:len(e.continueTargets)-1]
+	e.emitl(loopstep)
+	if f.Step != nil {
+		e.emitStatement(f.Step)
+	}
+	e.emitTerminator("br label %%%s\n", loopbegin)
+	e.emitl(loopexit)
+}
+
+// Constant case values become an LLVM switch, case ranges are tested
+// in order if none of the single values matched. The type checker ensures
+// no two cases overlap, so the order of tests does not matter.
+func (e *emitter) emitSwitch(s *parse.Switch) {
+	after := e.newLLVMLabel()
+	defaultLabel := after
+	caseLabels := make([]string, len(s.Cases))
+	for idx, c := range s.Cases {
+		caseLabels[idx] = e.newLLVMLabel()
+		if c.IsDefault {
+			defaultLabel = caseLabels[idx]
+		}
+	}
+
+	if s.Expr == nil {
+		for idx, c := range s.Cases {
+			for _, cond := range c.Values {
+				v := e.emitCondition(cond)
+				next := e.newLLVMLabel()
+				e.emitTerminator("br i1 %s, label %%%s, label %%%s\n", v.getLLVMRepr(), caseLabels[idx], next)
+				e.emitl(next)
+			}
+		}
+		e.emitTerminator("br label %%%s\n", defaultLabel)
+	} else {
+		tag := e.emitRValue(e.emitExpression(s.Expr))
+		llty := e.gTypeToLLVM(tag.getGType())
+		rangeLabel := e.newLLVMLabel()
+		dests := ""
+		for idx, c := range s.Cases {
+			for _, v := range c.Values {
+				if _, isRange := v.(*parse.CaseRange); isRange {
+					continue
+				}
+				cv, _ := e.r.ConstantValue(v)
+				dests += fmt.Sprintf(" %s %s, label %%%s", llty, constantToLLVM(cv), caseLabels[idx])
+			}
+		}
+		e.emitTerminator("switch %s %s, label %%%s [%s ]\n", llty, tag.getLLVMRepr(), rangeLabel, dests)
+		e.emitl(rangeLabel)
+		for idx, c := range s.Cases {
+			for _, v := range c.Values {
+				rng, isRange := v.(*parse.CaseRange)
+				if !isRange {
+					continue
+				}
+				lo := e.emitExpression(rng.Low)
+				hi := e.emitExpression(rng.High)
+				aboveLo := e.emitBinop2(parse.GTEQ, tag, lo)
+				belowHi := e.emitBinop2(parse.LTEQ, tag, hi)
+				inRange := e.emitBinop2('&', aboveLo, belowHi)
+				next := e.newLLVMLabel()
+				e.emitTerminator("br i1 %s, label %%%s, label %%%s\n", inRange.getLLVMRepr(), caseLabels[idx], next)
+				e.emitl(next)
+			}
+		}
+		e.emitTerminator("br label %%%s\n", defaultLabel)
+	}
+
+	e.pushBreakTarget(after)
+	for idx, c := range s.Cases {
+		e.emitl(caseLabels[idx])
+		e.emitBlock(c.Body)
+		// Cases do not fall through.
+		if !e.isCurBlockTerminated {
+			e.emitTerminator("br label %%%s\n", after)
+		}
+	}
+	e.popBreakTarget()
+	e.emitl(after)
+}
+
+// Returns a pointer to field idx of the aggregate lvalue v.
+func (e *emitter) emitFieldAddr(v Value, idx int, fieldType resolve.GType) Value {
+	ret := &exprValue{
+		llvmName: e.newLLVMName(),
+		lval:     true,
+		gType:    fieldType,
+	}
+	llty := e.gTypeToLLVM(v.getGType())
+	e.emiti("%s = getelementptr %s, %s* %s, i32 0, i32 %d\n", ret.llvmName, llty, llty, v.getLLVMRepr(), idx)
+	return ret
+}
+
+// Returns the payload of tagged union lvalue v viewed as variant idx.
+func (e *emitter) emitVariantAddr(v Value, u *resolve.GTaggedUnion, idx int) Value {
+	payload := e.newLLVMName()
+	llty := e.gTypeToLLVM(v.getGType())
+	e.emiti("%s = getelementptr %s, %s* %s, i32 0, i32 1\n", payload, llty, llty, v.getLLVMRepr())
+	ret := &exprValue{
+		llvmName: e.newLLVMName(),
+		lval:     true,
+		gType:    u.Types[idx],
+	}
+	e.emiti("%s = bitcast %s* %s to %s*\n", ret.llvmName, e.payloadToLLVM(u), payload, e.gTypeToLLVM(u.Types[idx]))
+	return ret
+}
+
+// Evaluate a tagged union expression as an lvalue.
+func (e *emitter) emitTaggedUnionLValue(n parse.Node) (Value, *resolve.GTaggedUnion) {
+	v := e.emitExpression(n)
+	if p, isPtr := underlying(v.getGType()).(*resolve.GPointer); isPtr {
+		v = &exprValue{
+			llvmName: e.emitRValue(v).getLLVMRepr(),
+			lval:     true,
+			gType:    p.PointsTo,
+		}
+	}
+	if !v.isLVal() {
+		v = e.emitSpill(v)
+	}
+	return v, underlying(v.getGType()).(*resolve.GTaggedUnion)
+}
+
+// Assigning to a variant sets the tag along with the payload.
+func (e *emitter) emitVariantAssign(sel *parse.Selector, r Value) {
+	v, u := e.emitTaggedUnionLValue(sel.Expr)
+	idx := u.VariantIndex(sel.Name)
+	tag := e.emitFieldAddr(v, 0, u.TagType())
+	e.emitStore(tag.getLLVMRepr(), &exprValue{fmt.Sprintf("%d", idx), false, u.TagType()})
+	e.emitStore(e.emitVariantAddr(v, u, idx).getLLVMRepr(), r)
+}
+
+func (e *emitter) emitMatch(m *parse.Match) {
+	v, u := e.emitTaggedUnionLValue(m.Expr)
+	tag := e.emitRValue(e.emitFieldAddr(v, 0, u.TagType()))
+	llty := e.gTypeToLLVM(u.TagType())
+
+	after := e.newLLVMLabel()
+	defaultLabel := after
+	caseLabels := make([]string, len(m.Cases))
+	dests := ""
+	for idx, c := range m.Cases {
+		caseLabels[idx] = e.newLLVMLabel()
+		if c.IsDefault {
+			defaultLabel = caseLabels[idx]
+		}
+		for _, name := range c.Values {
+			dests += fmt.Sprintf(" %s %d, label %%%s", llty, u.VariantIndex(name.(*parse.Ident).Val), caseLabels[idx])
+		}
+	}
+	e.emitTerminator("switch %s %s, label %%%s [%s ]\n", llty, tag.getLLVMRepr(), defaultLabel, dests)
+
+	e.pushBreakTarget(after)
+	for idx, c := range m.Cases {
+		e.emitl(caseLabels[idx])
+		if sym, ok := e.r.Lookup(c).(*resolve.MatchVarSymbol); ok {
+			variant := u.VariantIndex(c.Values[0].(*parse.Ident).Val)
+			e.slots[sym] = e.emitVariantAddr(v, u, variant).getLLVMRepr()
+		}
+		e.emitBlock(c.Body)
+		if !e.isCurBlockTerminated {
+			e.emitTerminator("br label %%%s\n", after)
+		}
+	}
+	e.popBreakTarget()
+	e.emitl(after)
+}
+
+// Evaluate a tuple expression to the rvalues of its elements.
+func (e *emitter) emitTupleElems(n parse.Node) []Value {
+	var ret []Value
+	if tup, ok := n.(*parse.Tuple); ok {
+		for _, elem := range tup.Elems {
+			ret = append(ret, e.emitRValue(e.emitExpression(elem)))
+		}
+		return ret
+	}
+	v := e.emitExpression(n)
+	if !v.isLVal() {
+		v = e.emitSpill(v)
+	}
+	tt := underlying(v.getGType()).(*resolve.GTuple)
+	for idx, t := range tt.Types {
+		ret = append(ret, e.emitRValue(e.emitFieldAddr(v, idx, t)))
+	}
+	return ret
+}
+
+// Every value on the right is evaluated before any is stored,
+// so a, b = b, a swaps.
+func (e *emitter) emitTupleAssign(ass *parse.Assign) {
+	var dests []Value
+	for _, elem := range ass.L.(*parse.Tuple).Elems {
+		dests = append(dests, e.emitExpression(elem))
+	}
+	for idx, v := range e.emitTupleElems(ass.R) {
+		e.emitStore(dests[idx].getLLVMRepr(), v)
+	}
+}
+
+func (e *emitter) emitAssign(ass *parse.Assign) {
+	if _, ok := ass.L.(*parse.Tuple); ok {
+		e.emitTupleAssign(ass)
+		return
+	}
+	if sel, ok := ass.L.(*parse.Selector); ok && e.isVariantSelector(sel) {
+		e.emitVariantAssign(sel, e.emitRValue(e.emitExpression(ass.R)))
+		return
+	}
+	l := e.emitExpression(ass.L)
+	r := e.emitRValue(e.emitExpression(ass.R))
+
+	switch ass.Op {
+	case parse.ADDASSIGN:
+		r = e.emitBinop2('+', e.emitRValue(l), r)
+	case parse.SUBASSIGN:
+		r = e.emitBinop2('-', e.emitRValue(l), r)
+	case parse.MULASSIGN:
+		r = e.emitBinop2('*', e.emitRValue(l), r)
+	case parse.ANDASSIGN:
+		r = e.emitBinop2('&', e.emitRValue(l), r)
+	case parse.ORASSIGN:
+		r = e.emitBinop2('|', e.emitRValue(l), r)
+	case parse.XORASSIGN:
+		r = e.emitBinop2('^', e.emitRValue(l), r)
+	case '=':
+		//pass
+	default:
+		panic(ass.Op)
+	}
+
+	if !l.isLVal() {
+		panic("internal error")
+	}
+	e.emitStore(l.getLLVMRepr(), r)
+}
+
+func (e *emitter) emitStore(llvmptr string, v Value) {
+	llty := e.gTypeToLLVM(v.getGType())
+	e.emiti("store %s %s, %s* %s\n", llty, v.getLLVMRepr(), llty, llvmptr)
+}
+
+func (e *emitter) emitReturn(r *parse.Return) {
+	if r.Expr == nil {
+		e.emitDefers(0)
+		e.emitTerminator("ret void\n")
+		return
+	}
+	// The result is computed before the defers run.
+	if isTuple(e.curFuncType.RetType) {
+		for idx, v := range e.emitTupleElems(r.Expr) {
+			e.emitStore(fmt.Sprintf("%%.ret%d", idx), v)
+		}
+		e.emitDefers(0)
+		e.emitTerminator("ret void\n")
+		return
+	}
+	v := e.emitRValue(e.emitExpression(r.Expr))
+	switch info := e.classify(e.curFuncType.RetType, true); info.class {
+	case abiCoerced:
+		mem, slot := e.emitCoercedSlot(v.getGType(), info)
+		e.emitStore(slot, v)
+		coerced := e.emitLoadCoerced(mem, info)
+		e.emitDefers(0)
+		e.emitTerminator("ret %s %s\n", info.coercedType(), coerced)
+	case abiIndirect:
+		e.emitStore("%.sret", v)
+		e.emitDefers(0)
+		e.emitTerminator("ret void\n")
+	default:
+		e.emitDefers(0)
+		e.emitTerminator("ret %s %s\n", e.gTypeToLLVM(v.getGType()), v.getLLVMRepr())
+	}
+}
+
+func (e *emitter) emitZeroMem(name string, t resolve.GType) {
+	llty := e.gTypeToLLVM(t)
+	e.emiti("store %s zeroinitializer, %s* %s\n", llty, llty, name)
+}
+
+// Load the value of an lvalue, other values are returned unchanged.
+func (e *emitter) emitRValue(v Value) Value {
+	if !v.isLVal() {
+		return v
+	}
+	name := e.newLLVMName()
+	llty := e.gTypeToLLVM(v.getGType())
+	e.emiti("%s = load %s, %s* %s\n", name, llty, llty, v.getLLVMRepr())
+	return &exprValue{
+		llvmName: name,
+		lval:     false,
+		gType:    v.getGType(),
+	}
+}
+
+// Rvalue aggregates are spilled to the stack so they can be addressed.
+func (e *emitter) emitSpill(v Value) Value {
+	slot := e.emitAlloca(v.getGType())
+	e.emitStore(slot, v)
+	return &exprValue{
+		llvmName: slot,
+		lval:     true,
+		gType:    v.getGType(),
+	}
+}
+
+func constantToLLVM(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case *big.Int:
+		// LLVM accepts values in either the signed or unsigned range.
+		return v.String()
+	case *big.Float:
+		// LLVM float and double constants are both written as the bits of
+		// a double, the checker already rounded float32 values.
+		f, _ := v.Float64()
+		return fmt.Sprintf("0x%016X", math.Float64bits(f))
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	panic("internal error")
+}
+
+func (e *emitter) emitExpression(expr parse.Node) Value {
+	v, isConst := e.r.ConstantValue(expr)
+	if isConst {
+		return &exprValue{
+			llvmName: constantToLLVM(v),
+			lval:     false,
+			gType:    e.r.TypeOf(expr),
+		}
+	}
+	switch expr := expr.(type) {
+	case *parse.Call:
+		return e.emitCall(expr)
+	case *parse.Binop:
+		return e.emitBinop(expr)
+	case *parse.Unop:
+		return e.emitUnop(expr)
+	case *parse.IndexInto:
+		return e.emitIndex(expr)
+	case *parse.Selector:
+		return e.emitSelector(expr)
+	case *parse.Ident:
+		return e.emitIdent(expr)
+	case *parse.Tuple:
+		return e.emitTuple(expr)
+	case *parse.Initializer:
+		return e.emitInitializer(expr)
+	case *parse.String:
+		return &exprValue{e.stringToLLVM(expr.Val), false, e.r.TypeOf(expr)}
+	case *parse.New:
+		return e.emitNew(expr)
+	default:
+		panic(expr)
+	}
+}
+
+// Composite literals are built in a zeroed stack temporary,
+// so omitted elements are zero.
+func (e *emitter) emitInitializer(lit *parse.Initializer) Value {
+	ret := &exprValue{
+		llvmName: e.emitAlloca(e.r.TypeOf(lit)),
+		lval:     true,
+		gType:    e.r.TypeOf(lit),
+	}
+	e.emitZeroMem(ret.llvmName, ret.gType)
+	e.emitInitializerElems(lit, ret)
+	return ret
+}
+
+// Taking the address of a composite literal allocates it like new, so
+// each evaluation gives a new object which outlives the function.
+func (e *emitter) emitInitializerAddr(u *parse.Unop, lit *parse.Initializer) Value {
+	ret := e.emitAllocate(e.r.TypeOf(u))
+	e.emitInitializerElems(lit, &exprValue{ret.getLLVMRepr(), true, e.r.TypeOf(lit)})
+	return ret
+}
+
+// Store the elements of a composite literal into the zeroed lvalue v.
+func (e *emitter) emitInitializerElems(lit *parse.Initializer, v Value) {
+	for pos, sub := range lit.Sub {
+		idx, sub := e.literalElem(lit, pos, sub)
+		elem := e.emitRValue(e.emitExpression(sub))
+		e.emitStore(e.emitFieldAddr(v, idx, elem.getGType()).getLLVMRepr(), elem)
+	}
+}
+
+// Tuple values are built in a stack temporary.
+func (e *emitter) emitTuple(t *parse.Tuple) Value {
+	ret := &exprValue{
+		llvmName: e.emitAlloca(e.r.TypeOf(t)),
+		lval:     true,
+		gType:    e.r.TypeOf(t),
+	}
+	tt := underlying(ret.gType).(*resolve.GTuple)
+	for idx, elem := range t.Elems {
+		v := e.emitRValue(e.emitExpression(elem))
+		e.emitStore(e.emitFieldAddr(ret, idx, tt.Types[idx]).getLLVMRepr(), v)
+	}
+	return ret
+}
+
+func (e *emitter) emitIndex(i *parse.IndexInto) Value {
+	v := e.emitExpression(i.Expr)
+	if isTuple(v.getGType()) {
+		if !v.isLVal() {
+			v = e.emitSpill(v)
+		}
+		idx, _ := e.r.ConstantValue(i.Index)
+		return e.emitFieldAddr(v, int(idx.(*big.Int).Int64()), e.r.TypeOf(i))
+	}
+	idx := e.emitIntCast(e.emitRValue(e.emitExpression(i.Index)), builtinIndexGType)
+
+	retv := &exprValue{}
+	retv.lval = true
+	retv.llvmName = e.newLLVMName()
+	retv.gType = e.r.TypeOf(i)
+
+	switch t := underlying(v.getGType()).(type) {
+	case *resolve.GArray:
+		if !v.isLVal() {
+			v = e.emitSpill(v)
+		}
+		llty := e.gTypeToLLVM(v.getGType())
+		e.emiti("%s = getelementptr %s, %s* %s, i64 0, i64 %s\n", retv.llvmName, llty, llty, v.getLLVMRepr(), idx.getLLVMRepr())
+	case *resolve.GPointer:
+		v = e.emitRValue(v)
+		llty := e.gTypeToLLVM(t.PointsTo)
+		e.emiti("%s = getelementptr %s, %s* %s, i64 %s\n", retv.llvmName, llty, llty, v.getLLVMRepr(), idx.getLLVMRepr())
+	default:
+		panic("internal error")
+	}
+	return retv
+}
+
+func (e *emitter) emitSelector(s *parse.Selector) Value {
+	if sym := e.r.Lookup(s); sym != nil {
+		// pkg.Name refers to a symbol of an imported package.
+		return e.emitSymbol(s, sym)
+	}
+	v := e.emitExpression(s.Expr)
+	// Selecting through a pointer to a struct dereferences it.
+	p, isPtr := underlying(v.getGType()).(*resolve.GPointer)
+	if isPtr {
+		v = &exprValue{
+			llvmName: e.emitRValue(v).getLLVMRepr(),
+			lval:     true,
+			gType:    p.PointsTo,
+		}
+	}
+	if !v.isLVal() {
+		v = e.emitSpill(v)
+	}
+	if _, isUnion := underlying(v.getGType()).(*resolve.GUnion); isUnion {
+		// All union members are at offset zero.
+		ret := &exprValue{
+			llvmName: e.newLLVMName(),
+			lval:     true,
+			gType:    e.r.TypeOf(s),
+		}
+		e.emiti("%s = bitcast %s* %s to %s*\n", ret.llvmName, e.gTypeToLLVM(v.getGType()), v.getLLVMRepr(), e.gTypeToLLVM(ret.gType))
+		return ret
+	}
+	st := underlying(v.getGType()).(*resolve.GStruct)
+	ret := &exprValue{
+		llvmName: e.newLLVMName(),
+		lval:     true,
+		gType:    e.r.TypeOf(s),
+	}
+	llty := e.gTypeToLLVM(v.getGType())
+	e.emiti("%s = getelementptr %s, %s* %s, i32 0, i32 %d\n", ret.llvmName, llty, llty, v.getLLVMRepr(), st.FieldIndex(s.Name))
+	return ret
+}
+
+// Conversions have C semantics, floats converted to integers are truncated
+// towards zero and pointers are reinterpreted.
+func (e *emitter) emitConversion(c *parse.Call) Value {
+	to := e.r.TypeOf(c)
+	v := e.emitExpression(c.Args[0])
+	from := v.getGType()
+	if !isScalar(from) {
+		// Aggregates only convert between types with the same underlying
+		// type, so the value is reinterpreted in memory.
+		if !v.isLVal() {
+			v = e.emitSpill(v)
+		}
+		if e.gTypeToLLVM(from) == e.gTypeToLLVM(to) {
+			return &exprValue{v.getLLVMRepr(), true, to}
+		}
+		ret := &exprValue{e.newLLVMName(), true, to}
+		e.emiti("%s = bitcast %s* %s to %s*\n", ret.llvmName, e.gTypeToLLVM(from), v.getLLVMRepr(), e.gTypeToLLVM(to))
+		return ret
+	}
+	v = e.emitRValue(v)
+	if e.gTypeToLLVM(from) == e.gTypeToLLVM(to) {
+		return &exprValue{v.getLLVMRepr(), false, to}
+	}
+	fromFloat, toFloat := isFloat(from), isFloat(to)
+	op := ""
+	switch {
+	case isPointer(from) && isPointer(to):
+		op = "bitcast"
+	case isPointer(from):
+		op = "ptrtoint"
+	case isPointer(to):
+		op = "inttoptr"
+	case !fromFloat && !toFloat:
+		return e.emitIntCast(v, to)
+	case fromFloat && toFloat:
+		fromBits := underlying(from).(*resolve.GFloat).Bits
+		toBits := underlying(to).(*resolve.GFloat).Bits
+		op = "fptrunc"
+		if fromBits < toBits {
+			op = "fpext"
+		}
+	case fromFloat:
+		op = "fptoui"
+		if isSigned(to) {
+			op = "fptosi"
+		}
+	default:
+		op = "uitofp"
+		if isSigned(from) {
+			op = "sitofp"
+		}
+	}
+	ret := &exprValue{e.newLLVMName(), false, to}
+	e.emiti("%s = %s %s %s to %s\n", ret.llvmName, op, e.gTypeToLLVM(from), v.getLLVMRepr(), e.gTypeToLLVM(to))
+	return ret
+}
+
+func (e *emitter) emitCall(c *parse.Call) Value {
+	if e.r.IsConversion(c) {
+		return e.emitConversion(c)
+	}
+	callee := e.emitRValue(e.emitExpression(c.FuncLike))
+	p := underlying(callee.getGType()).(*resolve.GPointer)
+	funcType := underlying(p.PointsTo).(*resolve.GFunc)
+
+	var args []string
+	var results Value
+	retInfo := e.classify(funcType.RetType, true)
+	if tt, ok := underlying(funcType.RetType).(*resolve.GTuple); ok {
+		results = &exprValue{
+			llvmName: e.emitAlloca(funcType.RetType),
+			lval:     true,
+			gType:    funcType.RetType,
+		}
+		for idx, t := range tt.Types {
+			p := e.emitFieldAddr(results, idx, t)
+			args = append(args, fmt.Sprintf("%s* %s", e.gTypeToLLVM(t), p.getLLVMRepr()))
+		}
+	} else if retInfo.class == abiIndirect {
+		results = &exprValue{
+			llvmName: e.emitAlloca(funcType.RetType),
+			lval:     true,
+			gType:    funcType.RetType,
+		}
+		args = append(args, e.indirectParam(funcType.RetType, "sret", true)+" "+results.getLLVMRepr())
+	}
+	for _, argNode := range c.Args {
+		arg := e.emitRValue(e.emitExpression(argNode))
+		args = append(args, e.emitLowerArg(arg)...)
+	}
+	if results != nil {
+		e.emiti("call void %s(%s)\n", callee.getLLVMRepr(), strings.Join(args, ", "))
+		return results
+	}
+	if isVoid(funcType.RetType) {
+		e.emiti("call void %s(%s)\n", callee.getLLVMRepr(), strings.Join(args, ", "))
+		return &exprValue{
+			llvmName: "void",
+			gType:    funcType.RetType,
+			lval:     false,
+		}
+	}
+	if retInfo.class == abiCoerced {
+		mem, slot := e.emitCoercedSlot(funcType.RetType, retInfo)
+		coerced := e.newLLVMName()
+		e.emiti("%s = call %s %s(%s)\n", coerced, retInfo.coercedType(), callee.getLLVMRepr(), strings.Join(args, ", "))
+		e.emiti("store %s %s, %s* %s\n", retInfo.coercedType(), coerced, retInfo.coercedType(), mem)
+		return &exprValue{
+			llvmName: slot,
+			gType:    funcType.RetType,
+			lval:     true,
+		}
+	}
+	ret := &exprValue{
+		llvmName: e.newLLVMName(),
+		gType:    funcType.RetType,
+		lval:     false,
+	}
+	e.emiti("%s = call %s %s(%s)\n", ret.llvmName, e.gTypeToLLVM(funcType.RetType), callee.getLLVMRepr(), strings.Join(args, ", "))
+	return ret
+}
+
+func (e *emitter) emitIdent(i *parse.Ident) Value {
+	return e.emitSymbol(i, e.r.Lookup(i))
+}
+
+// Emit a reference to the symbol named by n.
+func (e *emitter) emitSymbol(n parse.Node, s resolve.Symbol) Value {
+	switch s := s.(type) {
+	case *resolve.LocalSymbol:
+		return &exprValue{
+			llvmName: e.slots[s],
+			lval:     true,
+			gType:    s.Type,
+		}
+	case *resolve.ArgSymbol:
+		return &exprValue{
+			llvmName: fmt.Sprintf("%%.arg%d.addr", s.Idx),
+			lval:     true,
+			gType:    s.Type,
+		}
+	case *resolve.GlobalSymbol:
+		if s.Pkg != e.r.Package().Path {
+			e.useExtern(s)
+		}
+		return &exprValue{
+			llvmName: "@" + linkName(s.Pkg, s.Name),
+			lval:     true,
+			gType:    s.Type,
+		}
+	case *resolve.MatchVarSymbol:
+		return &exprValue{
+			llvmName: e.slots[s],
+			lval:     true,
+			gType:    s.Type,
+		}
+	case *resolve.FuncSymbol:
+		if s.Pkg != e.r.Package().Path {
+			e.useExtern(s)
+		}
+		return &exprValue{
+			llvmName: "@" + linkName(s.Pkg, s.Name),
+			lval:     false,
+			gType:    e.r.TypeOf(n),
+		}
+	default:
+		panic("internal error")
+	}
+}
+
+// Strip any names from a type.
+func underlying(t resolve.GType) resolve.GType {
+	for {
+		named, ok := t.(*resolve.GNamedType)
+		if !ok {
+			return t
+		}
+		t = named.Type
+	}
+}
+
+func isTuple(t resolve.GType) bool {
+	_, ok := underlying(t).(*resolve.GTuple)
+	return ok
+}
+
+func isVoid(t resolve.GType) bool {
+	_, ok := underlying(t).(*resolve.GVoid)
+	return ok
+}
+
+func isPointer(t resolve.GType) bool {
+	_, ok := underlying(t).(*resolve.GPointer)
+	return ok
+}
+
+// Scalars are held in registers, everything else is an aggregate.
+func isScalar(t resolve.GType) bool {
+	switch underlying(t).(type) {
+	case *resolve.GInt, *resolve.GFloat, *resolve.GPointer, *resolve.GEnum:
+		return true
+	}
+	return false
+}
+
+func isFloat(t resolve.GType) bool {
+	_, ok := underlying(t).(*resolve.GFloat)
+	return ok
+}
+
+func isSigned(t resolve.GType) bool {
+	v, ok := underlying(t).(*resolve.GInt)
+	return ok && v.Signed
+}
+
+// Convert an integer rvalue to another integer type.
+func (e *emitter) emitIntCast(v Value, to resolve.GType) Value {
+	from := underlying(v.getGType()).(*resolve.GInt)
+	toInt := underlying(to).(*resolve.GInt)
+	if from.Bits == toInt.Bits {
+		return &exprValue{v.getLLVMRepr(), false, to}
+	}
+	op := "trunc"
+	if from.Bits < toInt.Bits {
+		op = "zext"
+		if from.Signed {
+			op = "sext"
+		}
+	}
+	ret := &exprValue{e.newLLVMName(), false, to}
+	e.emiti("%s = %s %s %s to %s\n", ret.llvmName, op, e.gTypeToLLVM(from), v.getLLVMRepr(), e.gTypeToLLVM(toInt))
+	return ret
+}
+
+// Emit a binary operation on two rvalues. Shifts may have a right hand side
+// of a different integer type, everything else has operands of the same type.
+func (e *emitter) emitBinop2(op parse.TokenKind, l, r Value) Value {
+	llty := e.gTypeToLLVM(l.getGType())
+	if isFloat(l.getGType()) {
+		return e.emitFloatBinop(op, l, r)
+	}
+
+	signed := isSigned(l.getGType())
+	pick := func(s, u string) string {
+		if signed {
+			return s
+		}
+		return u
+	}
+
+	cmp := ""
+	switch op {
+	case parse.EQ:
+		cmp = "eq"
+	case parse.NEQ:
+		cmp = "ne"
+	case '<':
+		cmp = pick("slt", "ult")
+	case parse.LTEQ:
+		cmp = pick("sle", "ule")
+	case '>':
+		cmp = pick("sgt", "ugt")
+	case parse.GTEQ:
+		cmp = pick("sge", "uge")
+	}
+	if cmp != "" {
+		ret := &exprValue{
+			llvmName: e.newLLVMName(),
+			gType:    builtinBoolGType,
+			lval:     false,
+		}
+		e.emiti("%s = icmp %s %s %s, %s\n", ret.llvmName, cmp, llty, l.getLLVMRepr(), r.getLLVMRepr())
+		return ret
+	}
+
+	ret := &exprValue{
+		llvmName: e.newLLVMName(),
+		gType:    l.getGType(),
+		lval:     false,
+	}
+
+	inst := ""
+	switch op {
+	case parse.RSHIFT:
+		inst = pick("ashr", "lshr")
+		r = e.emitIntCast(r, l.getGType())
+	case parse.LSHIFT:
+		inst = "shl"
+		r = e.emitIntCast(r, l.getGType())
+	case '+':
+		inst = "add"
+	case '-':
+		inst = "sub"
+	case '*':
+		inst = "mul"
+	case '/':
+		inst = pick("sdiv", "udiv")
+	case '%':
+		inst = pick("srem", "urem")
+	case '^':
+		inst = "xor"
+	case '|':
+		inst = "or"
+	case '&':
+		inst = "and"
+	case parse.ANDNOT:
+		inverted := e.newLLVMName()
+		e.emiti("%s = xor %s %s, -1\n", inverted, llty, r.getLLVMRepr())
+		e.emiti("%s = and %s %s, %s\n", ret.llvmName, llty, l.getLLVMRepr(), inverted)
+		return ret
+	default:
+		panic(op)
+	}
+	e.emiti("%s = %s %s %s, %s\n", ret.llvmName, inst, llty, l.getLLVMRepr(), r.getLLVMRepr())
+	return ret
+}
+
+// Float comparisons are ordered except !=, so like C any comparison
+// involving a NaN is false except !=.
+func (e *emitter) emitFloatBinop(op parse.TokenKind, l, r Value) Value {
+	llty := e.gTypeToLLVM(l.getGType())
+	cmp := ""
+	switch op {
+	case parse.EQ:
+		cmp = "oeq"
+	case parse.NEQ:
+		cmp = "une"
+	case '<':
+		cmp = "olt"
+	case parse.LTEQ:
+		cmp = "ole"
+	case '>':
+		cmp = "ogt"
+	case parse.GTEQ:
+		cmp = "oge"
+	}
+	if cmp != "" {
+		ret := &exprValue{e.newLLVMName(), false, builtinBoolGType}
+		e.emiti("%s = fcmp %s %s %s, %s\n", ret.llvmName, cmp, llty, l.getLLVMRepr(), r.getLLVMRepr())
+		return ret
+	}
+	inst := ""
+	switch op {
+	case '+':
+		inst = "fadd"
+	case '-':
+		inst = "fsub"
+	case '*':
+		inst = "fmul"
+	case '/':
+		inst = "fdiv"
+	default:
+		panic(op)
+	}
+	ret := &exprValue{e.newLLVMName(), false, l.getGType()}
+	e.emiti("%s = %s %s %s, %s\n", ret.llvmName, inst, llty, l.getLLVMRepr(), r.getLLVMRepr())
+	return ret
+}
+
+func (e *emitter) emitBinop(b *parse.Binop) Value {
+	if b.Op == parse.AND || b.Op == parse.OR {
+		return e.emitLogicalBinop(b)
+	}
+	l := e.emitRValue(e.emitExpression(b.L))
+	r := e.emitRValue(e.emitExpression(b.R))
+	return e.emitBinop2(b.Op, l, r)
+}
+
+// && and || only evaluate their right hand side if needed.
+func (e *emitter) emitLogicalBinop(b *parse.Binop) Value {
+	l := e.emitCondition(b.L)
+	result := e.emitAlloca(builtinBoolGType)
+	e.emitStore(result, l)
+	rhs := e.newLLVMLabel()
+	after := e.newLLVMLabel()
+	if b.Op == parse.AND {
+		e.emitTerminator("br i1 %s, label %%%s, label %%%s\n", l.getLLVMRepr(), rhs, after)
+	} else {
+		e.emitTerminator("br i1 %s, label %%%s, label %%%s\n", l.getLLVMRepr(), after, rhs)
+	}
+	e.emitl(rhs)
+	r := e.emitCondition(b.R)
+	e.emitStore(result, r)
+	e.emitl(after)
+	return &exprValue{
+		llvmName: result,
+		lval:     true,
+		gType:    e.r.TypeOf(b),
+	}
+}
+
+func (e *emitter) emitUnop(u *parse.Unop) Value {
+	if lit, ok := u.Expr.(*parse.Initializer); ok && u.Op == '&' {
+		return e.emitInitializerAddr(u, lit)
+	}
+	v := e.emitExpression(u.Expr)
+
+	switch u.Op {
+	case '&':
+		return &exprValue{
+			lval:     false,
+			llvmName: v.getLLVMRepr(),
+			gType:    e.r.TypeOf(u),
+		}
+	case '*':
+		return &exprValue{
+			lval:     true,
+			gType:    e.r.TypeOf(u),
+			llvmName: e.emitRValue(v).getLLVMRepr(),
+		}
+	case '-':
+		v = e.emitRValue(v)
+		ret := &exprValue{e.newLLVMName(), false, e.r.TypeOf(u)}
+		if isFloat(v.getGType()) {
+			e.emiti("%s = fneg %s %s\n", ret.llvmName, e.gTypeToLLVM(v.getGType()), v.getLLVMRepr())
+			return ret
+		}
+		e.emiti("%s = sub %s 0, %s\n", ret.llvmName, e.gTypeToLLVM(v.getGType()), v.getLLVMRepr())
+		return ret
+	case '!':
+		v = e.emitRValue(v)
+		ret := &exprValue{e.newLLVMName(), false, e.r.TypeOf(u)}
+		e.emiti("%s = xor i1 %s, 1\n", ret.llvmName, v.getLLVMRepr())
+		return ret
+	}
+	panic("internal error")
+}
+
+func (e *emitter) structToLLVM(t *resolve.GStruct) string {
+	ret := "{"
+	for idx, subt := range t.Types {
+		ret += " " + e.gTypeToLLVM(subt)
+		if idx != len(t.Types)-1 {
+			ret += ","
+		}
+	}
+	ret += " }"
+	return ret
+}
+
+// A union is lowered to an array of integers the size of its most aligned
+// member, giving the same size and alignment as the C union.
+func (e *emitter) unionToLLVM(u *resolve.GUnion) string {
+	size := resolve.SizeOf(e.machine, u)
+	align := resolve.AlignOf(e.machine, u)
+	return fmt.Sprintf("{ [%d x i%d] }", size/align, align*8)
+}
+
+// A tagged union is its tag followed by an array of the payload's
+// alignment sized integers, so LLVM places the payload where a C
+// compiler would.
+func (e *emitter) taggedUnionToLLVM(u *resolve.GTaggedUnion) string {
+	return fmt.Sprintf("{ %s, %s }", e.gTypeToLLVM(u.TagType()), e.payloadToLLVM(u))
+}
+
+func (e *emitter) payloadToLLVM(u *resolve.GTaggedUnion) string {
+	_, size, align := resolve.TaggedUnionPayload(e.machine, u)
+	return fmt.Sprintf("[%d x i%d]", size/align, align*8)
+}
+
+func (e *emitter) isVariantSelector(sel *parse.Selector) bool {
+	t := e.r.TypeOf(sel.Expr)
+	if p, isPtr := underlying(t).(*resolve.GPointer); isPtr {
+		t = p.PointsTo
+	}
+	_, ok := underlying(t).(*resolve.GTaggedUnion)
+	return ok
+}
+
+func (e *emitter) gTypeToLLVM(t resolve.GType) string {
+	switch t := t.(type) {
+	case *resolve.GNamedType:
+		switch t.Type.(type) {
+		case *resolve.GStruct, *resolve.GUnion, *resolve.GTaggedUnion:
+			e.useNamedType(t)
+			return "%" + linkName(t.Pkg, t.Name)
+		}
+		return e.gTypeToLLVM(t.Type)
+	case *resolve.GUnion:
+		return e.unionToLLVM(t)
+	case *resolve.GTaggedUnion:
+		return e.taggedUnionToLLVM(t)
+	case *resolve.GVoid:
+		return "void"
+	case *resolve.GEnum:
+		return e.gTypeToLLVM(t.Type)
+	case *resolve.GFloat:
+		if t.Bits == 32 {
+			return "float"
+		}
+		return "double"
+	case *resolve.GStruct:
+		return e.structToLLVM(t)
+	case *resolve.GTuple:
+		return e.structToLLVM(&resolve.GStruct{Types: t.Types})
+	case *resolve.GPointer:
+		if isVoid(t.PointsTo) {
+			return "i8*"
+		}
+		return fmt.Sprintf("%s*", e.gTypeToLLVM(t.PointsTo))
+	case *resolve.GArray:
+		return fmt.Sprintf("[%d x %s]", t.Dim, e.gTypeToLLVM(t.SubType))
+	case *resolve.GFunc:
+		ret, params := e.lowerSignature(t, false)
+		return ret + " (" + strings.Join(params, ", ") + ")"
+	case *resolve.GInt:
+		switch t.Bits {
+		case 64:
+			return "i64"
+		case 32:
+			return "i32"
+		case 16:
+			return "i16"
+		case 8:
+			return "i8"
+		case 1:
+			return "i1"
+		default:
+			panic("unreachable.")
+		}
+	default:
+		panic("unreachable: bad gtype " + fmt.Sprintf("%v", t))
+	}
 }
@@ -4,6 +4,8 @@ package main
 // profiling, and other nice things.
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"github.com/andrewchambers/g/driver"
 	"github.com/andrewchambers/g/target"
@@ -11,29 +13,28 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
-func checkClangIsWorking() error {
+// Build a trivial program to check the tools driver.Build needs are present.
+func checkToolchainIsWorking() error {
 	tempdir, err := ioutil.TempDir("", "")
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(tempdir)
 
-	var progsrc []byte = []byte("int main() { return 0; }\n")
-	srcPath := path.Join(tempdir, "prog.c")
+	var progsrc []byte = []byte("package main\n\nfunc main() int {\n\treturn 0\n}\n")
+	srcPath := path.Join(tempdir, "prog.g")
 	err = ioutil.WriteFile(srcPath, progsrc, 0777)
 	if err != nil {
 		return err
 	}
-	cmd := exec.Command("clang", srcPath, "-o", path.Join(tempdir, "prog"))
-	err = cmd.Run()
-	if err != nil {
-		return err
-	}
-	return nil
+	opts := driver.BuildOptions{Output: path.Join(tempdir, "prog")}
+	return driver.Build(target.GetTarget(), opts, srcPath)
 }
 
 type testResult struct {
@@ -50,9 +51,22 @@ func makeFailedTestResult(name string, err string, args ...interface{}) testResu
 
 const retzerotestdir = "./gtestcases/retzero/singlefile/"
 
-func runSingleFileRetZero(t *testing.T, testpath string) (result testResult) {
+// Each folder is a main package, the packages it imports are in
+// subfolders of it.
+const multipackagetestdir = "./gtestcases/retzero/multipackage/"
+
+// Programs which must fail to compile. The diagnostics for x.g, or the
+// package folder x, are expected to be exactly the contents of x.err with
+// paths relative to the test directory.
+const compilefailtestdir = "./gtestcases/compilefail/singlefile/"
+const compilefailmultipackagetestdir = "./gtestcases/compilefail/multipackage/"
 
-	t.Logf("running test %s testpath")
+var update = flag.Bool("update", false, "Rewrite the .err files of the compilefail tests with the diagnostics reported.")
+
+// Build and run a test program, it passes if it exits with 0.
+func runRetZero(t *testing.T, testpath string, searchPath []string) (result testResult) {
+
+	t.Logf("running test %s", testpath)
 
 	// Recover and log failure on panic.
 	defer func() {
@@ -69,23 +83,15 @@ func runSingleFileRetZero(t *testing.T, testpath string) (result testResult) {
 	}
 	defer os.RemoveAll(tempdir)
 
-	llPath := path.Join(tempdir, "test.ll")
-	_ = path.Join(tempdir, "test")
-	outfile, err := os.Create(llPath)
-	if err != nil {
-		result = makeFailedTestResult(testpath, "failed to create file %s (%s)", outfile, err)
-		return
-	}
+	binPath := path.Join(tempdir, "test")
 	tm := target.GetTarget()
-	err = driver.CompilePackageToLLVM(tm, testpath, outfile)
-	if err != nil {
-		result = makeFailedTestResult(testpath, "failed to compile file (%s)", err)
-		return
+	opts := driver.BuildOptions{
+		Options: driver.Options{SearchPath: searchPath},
+		Output:  binPath,
 	}
-	binPath := path.Join(tempdir, "test.ll")
-	err = driver.LinkLLVMToBinary(llPath, binPath)
+	err = driver.Build(tm, opts, testpath)
 	if err != nil {
-		result = makeFailedTestResult(testpath, "failed to link file (%s)", err)
+		result = makeFailedTestResult(testpath, "failed to build (%s)", err)
 		return
 	}
 
@@ -103,11 +109,9 @@ func runSingleFileRetZero(t *testing.T, testpath string) (result testResult) {
 // Run all the SingleFileRetZero tests in parallel.
 func TestSingleFileRetZero(t *testing.T) {
 
-	t.Skip("skipping due to refactor.")
-
-	err := checkClangIsWorking()
+	err := checkToolchainIsWorking()
 	if err != nil {
-		t.Fatalf("clang failed to run %s", err)
+		t.Skipf("failed to build a test program %s", err)
 		return
 	}
 
@@ -132,12 +136,354 @@ func TestSingleFileRetZero(t *testing.T) {
 			continue
 		}
 
-		tr := runSingleFileRetZero(t, path.Join(retzerotestdir, info.Name()))
+		testpath := path.Join(retzerotestdir, info.Name())
+		t.Run(info.Name(), func(t *testing.T) {
+			t.Parallel()
+			tr := runRetZero(t, testpath, nil)
+			if tr.err != nil {
+				t.Errorf("%s failed. %s", tr.name, tr.err)
+			}
+		})
+	}
+
+}
+
+// Run all the MultiPackageRetZero tests in parallel.
+func TestMultiPackageRetZero(t *testing.T) {
+
+	err := checkToolchainIsWorking()
+	if err != nil {
+		t.Skipf("failed to build a test program %s", err)
+		return
+	}
 
-		if tr.err != nil {
-			t.Errorf("%s failed. %s", tr.name, tr.err)
+	dirs, err := ioutil.ReadDir(multipackagetestdir)
+	if err != nil {
+		t.Fatal("failed to read directory containing multi package retzero tests.")
+		return
+	}
+
+	for _, info := range dirs {
+		if !info.IsDir() {
+			continue
 		}
+		testpath := path.Join(multipackagetestdir, info.Name())
+		t.Run(info.Name(), func(t *testing.T) {
+			t.Parallel()
+			tr := runRetZero(t, testpath, []string{testpath})
+			if tr.err != nil {
+				t.Errorf("%s failed. %s", tr.name, tr.err)
+			}
+		})
+	}
 
+}
+
+// Compile a program which must fail and compare the errors reported with
+// the expected errors in errPath.
+func runCompileFail(t *testing.T, testdir, testpath string, searchPath []string, errPath string) {
+	opts := driver.Options{SearchPath: searchPath}
+	err := driver.CompilePackageToLLVM(target.GetTarget(), opts, testpath, ioutil.Discard)
+	if err == nil {
+		t.Errorf("%s compiled without errors", testpath)
+		return
+	}
+	var out bytes.Buffer
+	formatError(&out, err)
+	got := strings.Replace(out.String(), path.Clean(testdir)+"/", "", -1)
+	if *update {
+		err = ioutil.WriteFile(errPath, []byte(got), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(errPath)
+	if err != nil {
+		t.Errorf("failed to read expected errors (%s)", err)
+		return
 	}
+	if got != string(expected) {
+		t.Errorf("%s reported:\n%s\nexpected:\n%s", testpath, got, expected)
+	}
+}
+
+// Run all the SingleFileCompileFail tests in parallel.
+func TestSingleFileCompileFail(t *testing.T) {
+	files, err := filepath.Glob(path.Join(compilefailtestdir, "*.g"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("failed to read directory containing single file compilefail tests.")
+		return
+	}
+	for _, testpath := range files {
+		testpath := testpath
+		name := strings.TrimSuffix(path.Base(testpath), ".g")
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			runCompileFail(t, compilefailtestdir, testpath, nil, strings.TrimSuffix(testpath, ".g")+".err")
+		})
+	}
+}
+
+// Run all the MultiPackageCompileFail tests in parallel.
+func TestMultiPackageCompileFail(t *testing.T) {
+	dirs, err := ioutil.ReadDir(compilefailmultipackagetestdir)
+	if err != nil {
+		t.Fatal("failed to read directory containing multi package compilefail tests.")
+		return
+	}
+	for _, info := range dirs {
+		if !info.IsDir() {
+			continue
+		}
+		testpath := path.Join(compilefailmultipackagetestdir, info.Name())
+		t.Run(info.Name(), func(t *testing.T) {
+			t.Parallel()
+			runCompileFail(t, compilefailmultipackagetestdir, testpath, []string{testpath}, testpath+".err")
+		})
+	}
+}
+
+// A program whose packages are edited by TestMultiPackageStaleness. main
+// imports a and c, a imports b and uses its constant, so main's exit code
+// follows b.K.
+var stalenessSources = map[string]string{
+	"main.g": "package main\n\nimport (\n\t\"a\"\n\t\"c\"\n)\n\nfunc main() int {\n\treturn a.Twice() + c.Zero()\n}\n",
+	"a/a.g":  "package a\n\nimport \"b\"\n\nconst Doubled = b.K * 2\n\nfunc Twice() int {\n\treturn Doubled\n}\n",
+	"b/b.g":  "package b\n\nconst K = 0\n",
+	"c/c.g":  "package c\n\nfunc Zero() int {\n\treturn 0\n}\n",
+}
 
+// The keys of the build cache entries holding export data, by the import
+// path of their package, and the paths of the object files.
+func readBuildCache(t *testing.T, cacheDir string) (map[string][]string, []string) {
+	exports := make(map[string][]string)
+	exportPaths, err := filepath.Glob(filepath.Join(cacheDir, "*", "*-x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range exportPaths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The export data starts with "package <name> <path>".
+		fields := strings.Fields(strings.SplitN(string(data), "\n", 2)[0])
+		if len(fields) != 3 || fields[0] != "package" {
+			t.Fatalf("unexpected export data in %s", p)
+		}
+		exports[fields[2]] = append(exports[fields[2]], strings.TrimSuffix(filepath.Base(p), "-x"))
+	}
+	objects, err := filepath.Glob(filepath.Join(cacheDir, "*", "*-o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exports, objects
+}
+
+// Build the program and return its exit code.
+func buildAndRun(t *testing.T, opts driver.BuildOptions, srcDir string) int {
+	err := driver.Build(target.GetTarget(), opts, srcDir)
+	if err != nil {
+		t.Fatalf("failed to build (%s)", err)
+	}
+	err = exec.Command(opts.Output).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return 0
+}
+
+// Editing an imported package must give it new export data and rebuild
+// the packages importing it, while unrelated packages come from the cache.
+func TestMultiPackageStaleness(t *testing.T) {
+	err := checkToolchainIsWorking()
+	if err != nil {
+		t.Skipf("failed to build a test program %s", err)
+		return
+	}
+
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	srcDir := filepath.Join(tempdir, "src")
+	for name, src := range stalenessSources {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(p), 0777)
+		if err == nil {
+			err = ioutil.WriteFile(p, []byte(src), 0666)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cacheDir := filepath.Join(tempdir, "cache")
+	opts := driver.BuildOptions{
+		Options:  driver.Options{SearchPath: []string{srcDir}},
+		CacheDir: cacheDir,
+		Output:   filepath.Join(tempdir, "prog"),
+	}
+
+	if code := buildAndRun(t, opts, srcDir); code != 0 {
+		t.Fatalf("first build exited with %d", code)
+	}
+	exports, objects := readBuildCache(t, cacheDir)
+	for _, path := range []string{"a", "b", "c"} {
+		if len(exports[path]) != 1 {
+			t.Fatalf("expected one export data entry for %s, got %d", path, len(exports[path]))
+		}
+	}
+	if len(objects) != 4 {
+		t.Fatalf("expected 4 object files, got %d", len(objects))
+	}
+	before := make(map[string]time.Time)
+	for _, p := range objects {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[p] = fi.ModTime()
+	}
+
+	// Only b changes, a and main are stale through it.
+	err = ioutil.WriteFile(filepath.Join(srcDir, "b", "b.g"), []byte("package b\n\nconst K = 3\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := buildAndRun(t, opts, srcDir); code != 6 {
+		t.Fatalf("build after editing b exited with %d, expected 6", code)
+	}
+	newExports, newObjects := readBuildCache(t, cacheDir)
+	for _, path := range []string{"a", "b"} {
+		if len(newExports[path]) != 2 {
+			t.Errorf("expected new export data for %s, got %d entries", path, len(newExports[path]))
+		}
+	}
+	if len(newExports["c"]) != 1 {
+		t.Errorf("expected the export data of c to be reused, got %d entries", len(newExports["c"]))
+	}
+	// b, a and main are compiled again, c is not.
+	if len(newObjects) != 7 {
+		t.Errorf("expected 7 object files, got %d", len(newObjects))
+	}
+	for p, mtime := range before {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("cached object %s was rewritten", p)
+		}
+	}
+}
+
+// Compile with the given number of jobs and return the LLVM output and
+// the diagnostics as they are printed.
+func compileWithJobs(testpath string, jobs int) (string, string) {
+	opts := driver.Options{SearchPath: []string{testpath}, Jobs: jobs}
+	var out, diags bytes.Buffer
+	err := driver.CompilePackageToLLVM(target.GetTarget(), opts, testpath, &out)
+	if err != nil {
+		formatError(&diags, err)
+	}
+	return out.String(), diags.String()
+}
+
+// Compiling in parallel must give exactly the output of compiling one
+// package or file at a time, errors included. Run with -race.
+func TestParallelCompileIsDeterministic(t *testing.T) {
+	testpaths := []string{
+		path.Join(compilefailmultipackagetestdir, "parallel"),
+		path.Join(multipackagetestdir, "import1"),
+	}
+	for _, testpath := range testpaths {
+		expectedOut, expectedDiags := compileWithJobs(testpath, 1)
+		if expectedOut == "" && expectedDiags == "" {
+			t.Fatalf("%s gave no output", testpath)
+		}
+		for i := 0; i < 10; i++ {
+			out, diags := compileWithJobs(testpath, 8)
+			if diags != expectedDiags {
+				t.Fatalf("%s with 8 jobs reported:\n%s\nexpected:\n%s", testpath, diags, expectedDiags)
+			}
+			if out != expectedOut {
+				t.Fatalf("%s with 8 jobs gave different output", testpath)
+			}
+		}
+	}
+}
+
+// Packages implemented in C, each folder is a main package importing the
+// package cside. cside/cside.c is linked in place of the G package, whose
+// functions only give the C functions their types.
+const cabitestdir = "./gtestcases/cabi/"
+
+// Build a main package with the C implementation of cside and run it.
+func runCABI(t *testing.T, cc string, testpath string) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	llPath := filepath.Join(tempdir, "main.ll")
+	out, err := os.Create(llPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := driver.Options{SearchPath: []string{testpath}}
+	err = driver.CompilePackageToLLVM(target.GetTarget(), opts, testpath, out)
+	out.Close()
+	if err != nil {
+		t.Fatalf("failed to compile (%s)", err)
+	}
+	objPath := filepath.Join(tempdir, "main.o")
+	err = driver.AssembleLLVM(llPath, objPath)
+	if err != nil {
+		t.Fatalf("failed to assemble (%s)", err)
+	}
+	binPath := filepath.Join(tempdir, "test")
+	cmd := exec.Command(cc, objPath, filepath.Join(testpath, "cside", "cside.c"), "-o", binPath)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to link (%s)\n%s", err, msg)
+	}
+	err = exec.Command(binPath).Run()
+	if err != nil {
+		t.Fatalf("non zero exit code (%s)", err)
+	}
+}
+
+// Run all the CABI tests in parallel.
+func TestCABI(t *testing.T) {
+	err := checkToolchainIsWorking()
+	if err != nil {
+		t.Skipf("failed to build a test program %s", err)
+		return
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler to build the C side of the tests")
+		return
+	}
+
+	dirs, err := ioutil.ReadDir(cabitestdir)
+	if err != nil {
+		t.Fatal("failed to read directory containing C ABI tests.")
+		return
+	}
+	for _, info := range dirs {
+		if !info.IsDir() {
+			continue
+		}
+		testpath := path.Join(cabitestdir, info.Name())
+		t.Run(info.Name(), func(t *testing.T) {
+			t.Parallel()
+			runCABI(t, cc, testpath)
+		})
+	}
 }
@@ -0,0 +1,119 @@
+/* The C implementation of package cside. Functions are given the link
+   names of the G package, so G code calls them instead of the G stubs. */
+
+#include <stdint.h>
+
+union ints {
+	int32_t i;
+	uint8_t b[4];
+};
+
+union mixed {
+	int32_t a[3];
+	float f;
+};
+
+union floats {
+	double d;
+	float f[2];
+};
+
+union pair {
+	double d[2];
+};
+
+union sseint {
+	struct {
+		double d;
+		int64_t i;
+	} s;
+};
+
+union big {
+	int64_t a[4];
+	double d;
+};
+
+union single {
+	float f;
+};
+
+union ints add_ints(union ints u, int32_t n) __asm__("cside.AddInts");
+int32_t sum_mixed(union mixed u) __asm__("cside.SumMixed");
+union floats halve_floats(union floats u) __asm__("cside.HalveFloats");
+union pair swap_pair(union pair u) __asm__("cside.SwapPair");
+union sseint make_sseint(double d, int64_t i) __asm__("cside.MakeSSEInt");
+union big sum_big(union big a, union big b, union big c, int64_t n) __asm__("cside.SumBig");
+union single neg_single(union single u) __asm__("cside.NegSingle");
+int32_t call_g(void) __asm__("cside.CallG");
+
+/* Defined in G. */
+union ints gAddInts(union ints u, int32_t n);
+int32_t gSumMixed(union mixed u);
+union pair gPair(double a, double b);
+int64_t gSSEInt(union sseint u);
+union big gSumBig(union big a, union big b, union big c, int64_t n);
+float gSingle(union single u);
+
+union ints add_ints(union ints u, int32_t n) {
+	u.i += n;
+	return u;
+}
+
+int32_t sum_mixed(union mixed u) {
+	return u.a[0] + u.a[1] + u.a[2];
+}
+
+union floats halve_floats(union floats u) {
+	u.d /= 2;
+	return u;
+}
+
+union pair swap_pair(union pair u) {
+	double t = u.d[0];
+	u.d[0] = u.d[1];
+	u.d[1] = t;
+	return u;
+}
+
+union sseint make_sseint(double d, int64_t i) {
+	union sseint u;
+	u.s.d = d;
+	u.s.i = i;
+	return u;
+}
+
+union big sum_big(union big a, union big b, union big c, int64_t n) {
+	union big ret;
+	for (int i = 0; i < 4; i++)
+		ret.a[i] = a.a[i] + b.a[i] + c.a[i] + n;
+	return ret;
+}
+
+union single neg_single(union single u) {
+	u.f = -u.f;
+	return u;
+}
+
+int32_t call_g(void) {
+	union ints i = {.i = 1};
+	if (gAddInts(i, 2).i != 3)
+		return 1;
+	union mixed m = {.a = {4, 5, 6}};
+	if (gSumMixed(m) != 15)
+		return 2;
+	union pair p = gPair(1.5, 2.5);
+	if (p.d[0] != 1.5 || p.d[1] != 2.5)
+		return 3;
+	union sseint s = {.s = {3.0, 4}};
+	if (gSSEInt(s) != 7)
+		return 4;
+	union big a = {.a = {1, 2, 3, 4}}, b = {.a = {10, 20, 30, 40}}, c = {.a = {0}};
+	union big r = gSumBig(a, b, c, 100);
+	if (r.a[0] != 111 || r.a[3] != 144)
+		return 5;
+	union single f = {.f = 2.5f};
+	if (gSingle(f) != 2.5f)
+		return 6;
+	return 0;
+}
@@ -0,0 +1,75 @@
+package cside
+
+// The functions of this package are implemented in C by cside.c, which
+// is linked instead of this package. The bodies here only give their
+// types.
+
+type Ints union {
+	I int32
+	B [4]uint8
+}
+
+type Mixed union {
+	A [3]int32
+	F float32
+}
+
+type Floats union {
+	D float64
+	F [2]float32
+}
+
+type Pair union {
+	D [2]float64
+}
+
+type SSEInt union {
+	S struct {
+		D float64
+		I int64
+	}
+}
+
+type Big union {
+	A [4]int64
+	D float64
+}
+
+type Single union {
+	F float32
+}
+
+func AddInts(u Ints, n int32) Ints {
+	return u
+}
+
+func SumMixed(u Mixed) int32 {
+	return 0
+}
+
+func HalveFloats(u Floats) Floats {
+	return u
+}
+
+func SwapPair(u Pair) Pair {
+	return u
+}
+
+func MakeSSEInt(d float64, i int64) SSEInt {
+	var u SSEInt
+	return u
+}
+
+// Takes more unions than fit in registers.
+func SumBig(a Big, b Big, c Big, n int64) Big {
+	return a
+}
+
+func NegSingle(u Single) Single {
+	return u
+}
+
+// Calls the G functions of the main package, returns 0 if they behave.
+func CallG() int32 {
+	return 0
+}
@@ -0,0 +1,91 @@
+package main
+
+import "cside"
+
+// Called from C.
+func gAddInts(u cside.Ints, n int32) cside.Ints {
+	u.I = u.I + n
+	return u
+}
+
+func gSumMixed(u cside.Mixed) int32 {
+	return u.A[0] + u.A[1] + u.A[2]
+}
+
+func gPair(a float64, b float64) cside.Pair {
+	var u cside.Pair
+	u.D[0] = a
+	u.D[1] = b
+	return u
+}
+
+func gSSEInt(u cside.SSEInt) int64 {
+	return int64(u.S.D) + u.S.I
+}
+
+func gSumBig(a cside.Big, b cside.Big, c cside.Big, n int64) cside.Big {
+	var ret cside.Big
+	var i int
+	for i = 0; i < 4; i++ {
+		ret.A[i] = a.A[i] + b.A[i] + c.A[i] + n
+	}
+	return ret
+}
+
+func gSingle(u cside.Single) float32 {
+	return u.F
+}
+
+func main() int {
+	var i cside.Ints
+	i.I = 41
+	i = cside.AddInts(i, 1)
+	if i.I != 42 {
+		return 1
+	}
+	var m cside.Mixed
+	m.A[0] = 1
+	m.A[1] = 2
+	m.A[2] = 3
+	if cside.SumMixed(m) != 6 {
+		return 2
+	}
+	var f cside.Floats
+	f.D = 3.0
+	f = cside.HalveFloats(f)
+	if f.D != 1.5 {
+		return 3
+	}
+	var p cside.Pair
+	p.D[0] = 1.0
+	p.D[1] = 2.0
+	p = cside.SwapPair(p)
+	if p.D[0] != 2.0 || p.D[1] != 1.0 {
+		return 4
+	}
+	var s = cside.MakeSSEInt(2.5, 7)
+	if s.S.D != 2.5 || s.S.I != 7 {
+		return 5
+	}
+	var a, b, c cside.Big
+	var idx int
+	for idx = 0; idx < 4; idx++ {
+		a.A[idx] = int64(idx)
+		b.A[idx] = 10
+		c.A[idx] = 100
+	}
+	var big = cside.SumBig(a, b, c, 1000)
+	if big.A[0] != 1110 || big.A[3] != 1113 {
+		return 6
+	}
+	var one cside.Single
+	one.F = 4.0
+	if cside.NegSingle(one).F != -4.0 {
+		return 7
+	}
+	var failed = cside.CallG()
+	if failed != 0 {
+		return 10 + int(failed)
+	}
+	return 0
+}
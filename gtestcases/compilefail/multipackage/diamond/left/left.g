@@ -0,0 +1,7 @@
+package left
+
+import "shared"
+
+func L() int {
+	return shared.S()
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"left"
+	"right"
+)
+
+func main() int {
+	return left.L() + right.R()
+}
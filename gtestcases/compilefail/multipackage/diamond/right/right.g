@@ -0,0 +1,7 @@
+package right
+
+import "shared"
+
+func R() int {
+	return shared.S()
+}
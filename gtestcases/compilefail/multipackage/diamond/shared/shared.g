@@ -0,0 +1,9 @@
+package shared
+
+func S() int {
+	return missing
+}
+
+func T() bool {
+	return 1
+}
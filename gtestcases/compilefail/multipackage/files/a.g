@@ -0,0 +1,7 @@
+package main
+
+func main() int {
+	return f(true)
+}
+
+var a int = nil
@@ -0,0 +1,7 @@
+package main
+
+var b bool = 1
+
+func f(x int) int {
+	return x + y
+}
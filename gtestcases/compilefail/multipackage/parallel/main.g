@@ -0,0 +1,12 @@
+package main
+
+import (
+	"p"
+	"q"
+	"r"
+	"s"
+)
+
+func main() int {
+	return p.One() + q.Two() + r.Three() + s.Four()
+}
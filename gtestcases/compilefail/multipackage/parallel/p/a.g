@@ -0,0 +1,10 @@
+package p
+
+func Helperp() int {
+	var b bool = 1
+	return 0
+}
+
+func One() int {
+	return 1
+}
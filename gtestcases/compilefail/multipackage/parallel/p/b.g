@@ -0,0 +1,5 @@
+package p
+
+func Otherp() int {
+	return missingp
+}
@@ -0,0 +1,10 @@
+package q
+
+func Helperq() int {
+	var b bool = 1
+	return 0
+}
+
+func Two() int {
+	return 2
+}
@@ -0,0 +1,5 @@
+package q
+
+func Otherq() int {
+	return missingq
+}
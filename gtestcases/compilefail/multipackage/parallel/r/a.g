@@ -0,0 +1,10 @@
+package r
+
+func Helperr() int {
+	var b bool = 1
+	return 0
+}
+
+func Three() int {
+	return 3
+}
@@ -0,0 +1,5 @@
+package r
+
+func Otherr() int {
+	return missingr
+}
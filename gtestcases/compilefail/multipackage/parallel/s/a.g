@@ -0,0 +1,5 @@
+package s
+
+func Four() int {
+	return (4
+}
@@ -0,0 +1,5 @@
+package s
+
+func Five() int {
+	return 5 +
+}
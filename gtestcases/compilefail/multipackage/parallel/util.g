@@ -0,0 +1,6 @@
+package main
+
+func bad() int {
+	var x bool = 1
+	return undefinedInMain
+}
@@ -0,0 +1,63 @@
+package main
+
+type E enum { A B C }
+type F enum { X Y }
+
+func missing(e E) int {
+	switch e {
+	case A:
+		return 1
+	}
+	return 0
+}
+
+func missingAfterRange(e E) int {
+	switch e {
+	case A..B:
+		return 1
+	}
+	return 0
+}
+
+func duplicate(e E) int {
+	switch e {
+	case A, B, C:
+		return 1
+	case B:
+		return 2
+	}
+	return 0
+}
+
+func otherEnum(e E) int {
+	switch e {
+	case A, B, C:
+		return 1
+	case X:
+		return 2
+	case 1:
+		return 3
+	}
+	return 0
+}
+
+func mixed(e E, f F) int {
+	var i int = e
+	var g E = f
+	var ok bool = e == f
+	return i + e
+}
+
+// A default handles the remaining members.
+func withDefault(e E) int {
+	switch e {
+	case A:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func main() int {
+	return 0
+}
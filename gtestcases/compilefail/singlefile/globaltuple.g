@@ -0,0 +1,15 @@
+package main
+
+func f() int {
+	return 1
+}
+
+var g int = 2
+var t (int, int) = 1, f()
+var u = g, 3
+var v (int, bool) = 1, 2
+var w (int, int) = 1, 2, 3
+
+func main() int {
+	return 0
+}
@@ -0,0 +1,37 @@
+package main
+
+// Named types are only identical to themselves. Values of a named type
+// need an explicit conversion to or from any other type.
+
+type MyInt int
+type P *int
+
+func takesInt(x int) int {
+	return x
+}
+
+func main() int {
+	var m MyInt
+	var i int = m
+	var c char
+	var i8 int8 = c
+	var c2 char = i8
+	var u uint
+	var u64 uint64 = u
+	var u2 uint = u64
+	var i64 int64 = i
+	var p *int
+	var q P = p
+	var p2 *int = q
+	var sum int = i + m
+	takesInt(m)
+
+	// Constants and nil take on a named type, conversions are explicit.
+	var m2 MyInt = 3
+	var q2 P = nil
+	var m3 MyInt = MyInt(i)
+	var c3 char = char(i8)
+	var u3 uint64 = uint64(u)
+	var q3 P = P(p)
+	return int(m2) + int(m3) + int(c3) + int(u3)
+}
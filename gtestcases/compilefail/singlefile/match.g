@@ -0,0 +1,74 @@
+package main
+
+type T tunion {
+	i int
+	b bool
+	p *int
+}
+
+func nonExhaustive(t T) int {
+	match t {
+	case i:
+		return t
+	}
+	return 0
+}
+
+func duplicate(t T) int {
+	match t {
+	case i, b:
+		return 1
+	case b:
+		return 2
+	case p:
+		return 3
+	}
+	return 0
+}
+
+func badCases(t T) int {
+	match t {
+	case x:
+		return 1
+	case 1:
+		return 2
+	default:
+		return 3
+	default:
+		return 4
+	}
+	return 0
+}
+
+func notTunion(x int) int {
+	match x {
+	default:
+		return 1
+	}
+	return 0
+}
+
+// Only a case with a single variant gives the matched variable its type.
+func binding(t T) int {
+	match t {
+	case i:
+		var n int = t
+	case b, p:
+		var n int = t
+	}
+	return 0
+}
+
+func readOutside(t T, pt *T) int {
+	t.i = 1
+	pt.b = true
+	var n int = t.i
+	if pt.b {
+		return n
+	}
+	return t.q
+}
+
+func main() int {
+	return 0
+}
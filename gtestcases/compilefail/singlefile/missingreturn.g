@@ -0,0 +1,130 @@
+package main
+
+type E enum { A B }
+
+type T tunion {
+	I int
+	B bool
+}
+
+func noElse(x bool) int {
+	if x {
+		return 1
+	}
+}
+
+func emptyBody() int {
+}
+
+func brokenLoop() int {
+	for {
+		break
+	}
+}
+
+func loopWithCond(x int) int {
+	for x < 10 {
+		return x
+	}
+}
+
+func noDefault(e E) int {
+	switch e {
+	case A:
+		return 1
+	case B:
+		return 2
+	}
+}
+
+func caseFallsOut(x int) int {
+	switch x {
+	case 1:
+		return 1
+	default:
+	}
+}
+
+func breakInSwitch(x int) int {
+	switch x {
+	default:
+		if x > 0 {
+			break
+		}
+		return 0
+	}
+}
+
+func matchNoDefault(t T) int {
+	match t {
+	case I:
+		return 1
+	case B:
+		return 2
+	}
+}
+
+func tuple() (int, int) {
+	if true {
+		return 1, 2
+	}
+}
+
+// These all terminate.
+
+func ifElse(x bool) int {
+	if x {
+		return 1
+	} else if !x {
+		return 2
+	} else {
+		return 3
+	}
+}
+
+func forever(x int) int {
+	for {
+		for {
+			break
+		}
+		switch x {
+		case 1:
+			break
+		}
+		if x > 2 {
+			return x
+		}
+	}
+}
+
+func switchDefault(x int) int {
+	switch x {
+	case 1:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func matchDefault(t T) int {
+	match t {
+	case I:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func trailingEmpty() int {
+	return 0;
+}
+
+func noResult(x bool) {
+	if x {
+		return
+	}
+}
+
+func main() int {
+	return 0
+}
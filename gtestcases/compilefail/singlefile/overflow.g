@@ -0,0 +1,32 @@
+package main
+
+// Constants converted to a typed integer or float must be representable
+// in it, as must the results of typed constant arithmetic.
+
+const big = 1 << 70
+const small int8 = 300
+const neg uint8 = -1
+
+func main() int {
+	var a = int8(300)
+	var b = uint8(-1)
+	var c = uint16(65536)
+	var d = int64(big)
+	var e = uint(-1)
+	var f = float32(1e39)
+	var g = float64(1e309)
+	var h = int(1.5)
+	var i int8 = 128
+	var j = int8(100) + int8(100)
+	var k = uint8(0) - 1
+	var l = -int8(-128)
+	var m = char(256)
+
+	// These fit.
+	var n = int8(-128)
+	var o = uint8(255)
+	var p = uint64(1 << 63)
+	var q = float32(3.4e38)
+	var r = int(2.0)
+	return 0
+}
@@ -0,0 +1,15 @@
+package main
+
+// Globals are checked before functions, the errors are still reported
+// in source order.
+
+func f() int {
+	return true
+}
+
+func main() int {
+	var x int8 = 300
+	return f() + x
+}
+
+var g int = 1.5
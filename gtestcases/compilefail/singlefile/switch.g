@@ -0,0 +1,72 @@
+package main
+
+func cases(x int, y int) int {
+	switch x {
+	case 1, 2:
+		return 1
+	case 2..5:
+		return 2
+	case 1:
+		return 3
+	case 7..9, 9:
+		return 4
+	case 10, 12..11:
+		return 5
+	case y:
+		return 6
+	case 20..30, 15..25:
+		return 7
+	case 40:
+	default:
+		return 8
+	default:
+		return 9
+	}
+	return 0
+}
+
+func bools(b bool) int {
+	switch b {
+	case true:
+		return 1
+	case false, true:
+		return 2
+	case true..false:
+		return 3
+	}
+	return 0
+}
+
+func conditions(x int) int {
+	switch {
+	case x < 1:
+		return 1
+	case 1..2:
+		return 2
+	case x:
+		return 3
+	}
+	return 0
+}
+
+func badTag(f float64, p *int) int {
+	switch f {
+	case 1:
+		return 1
+	}
+	switch p {
+	case nil:
+		return 2
+	}
+	switch 1 {
+	case 300:
+		return 3
+	case 1.5:
+		return 4
+	}
+	return 0
+}
+
+func main() int {
+	return 0
+}
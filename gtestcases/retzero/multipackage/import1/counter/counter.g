@@ -0,0 +1,8 @@
+package counter
+
+var Count int
+
+func Add(n int) int {
+	Count = Count + n
+	return Count
+}
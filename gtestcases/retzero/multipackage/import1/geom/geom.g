@@ -0,0 +1,28 @@
+package geom
+
+import "counter"
+
+const Dims = 2
+
+type Point struct {
+	X int
+	Y int
+}
+
+type Rect struct {
+	Min Point
+	Max Point
+}
+
+func area(r Rect) int {
+	return (r.Max.X - r.Min.X) * (r.Max.Y - r.Min.Y)
+}
+
+func Area(r *Rect) int {
+	counter.Add(1)
+	return area(*r)
+}
+
+func Bounds(r Rect) (int, int) {
+	return r.Max.X - r.Min.X, r.Max.Y - r.Min.Y
+}
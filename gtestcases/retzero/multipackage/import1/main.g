@@ -0,0 +1,40 @@
+package main
+
+import (
+	"counter"
+	"geom"
+)
+
+type Point struct {
+	a int8
+}
+
+var origin geom.Point
+
+func main() int {
+	var r geom.Rect
+	r.Max = geom.Point{3, 4}
+	r.Min = origin
+	if geom.Area(&r) != 12 {
+		return 1
+	}
+	var w, h = geom.Bounds(r)
+	if w != 3 || h != 4 {
+		return 2
+	}
+	if counter.Count != 1 {
+		return 3
+	}
+	counter.Count = 10
+	if counter.Add(geom.Dims) != 12 {
+		return 4
+	}
+	var p = &r.Min
+	p.X = -1
+	if geom.Area(&r) != 16 {
+		return 5
+	}
+	var q Point
+	q.a = 1
+	return int(q.a) - 1
+}
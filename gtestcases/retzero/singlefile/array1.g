@@ -0,0 +1,11 @@
+package main
+
+func main() int {
+    var a [10]int
+    var i int
+    for i = 0; i < 10; i++ {
+        a[i] = i
+    }
+    var p *int = &a[0]
+    return a[9] + p[3] - 12
+}
@@ -0,0 +1,16 @@
+package main
+
+func main() int {
+    var x int
+    var y int
+    for x = 0; x < 100; x++ {
+        if x == 10 {
+            break
+        }
+        if x % 2 == 0 {
+            continue
+        }
+        y += 1
+    }
+    return x + y - 15
+}
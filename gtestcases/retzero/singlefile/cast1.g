@@ -0,0 +1,66 @@
+package main
+
+type Fd int32
+
+type point struct {
+	x int
+	y int
+}
+
+type vec point
+
+type Pair [2]int
+
+var null *int = (*int)(nil)
+
+func main() int {
+	var big int64 = 0x1_0000_00ff
+	var small = int8(big)
+	if small != -1 || uint8(big) != 255 {
+		return 1
+	}
+	if int64(small) != -1 || uint64(uint8(small)) != 255 {
+		return 2
+	}
+	if int32(uint16(small)) != 65535 {
+		return 3
+	}
+	var fd = Fd(3)
+	var raw int32 = int32(fd)
+	if raw != 3 || Fd(raw+1) != 4 {
+		return 4
+	}
+	var x int64 = 0x0102030405060708
+	var p = &x
+	var bytes = (*uint8)(p)
+	if bytes[0] != 8 || bytes[7] != 1 {
+		return 5
+	}
+	var addr = uintptr(p)
+	var back = (*int64)(addr)
+	if back != p || *back != x {
+		return 6
+	}
+	var pp = &p
+	if (**uint8)(pp)[0][1] != 7 {
+		return 7
+	}
+	if null != nil || (*uint8)(nil) != nil || uintptr((*int)(0)) != 0 {
+		return 8
+	}
+	var pt = point{1, 2}
+	var v = vec(pt)
+	if v.x != 1 || v.y != 2 || point(v).y != 2 {
+		return 9
+	}
+	var f = float64(small)
+	if f != -1 || int(f*2.5) != -2 {
+		return 10
+	}
+	var arr = [2]int{3, 4}
+	var pair = Pair(arr)
+	if pair[1] != 4 || [2]int(pair)[0] != 3 {
+		return 11
+	}
+	return 0
+}
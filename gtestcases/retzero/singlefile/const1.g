@@ -0,0 +1,53 @@
+package main
+
+const Size = Half * 2
+const Half = 1 << 4
+
+const (
+	Big   = 1 << 100
+	Small = Big >> 98
+	Mask  uint8 = 255
+	Neg   int8 = -128
+	On    = Small == 4
+)
+
+const MaxU uint64 = 18446744073709551615
+
+var table [32]int8 = {Small, Neg}
+
+func main() int {
+	var a int = Size
+	if a != 32 || Half != 16 {
+		return 1
+	}
+	if Small != 4 {
+		return 2
+	}
+	var m = Mask
+	m += 1
+	if m != 0 {
+		return 3
+	}
+	if !On {
+		return 4
+	}
+	if table[0] != 4 || table[1] != -128 {
+		return 5
+	}
+	var u = MaxU
+	if u+1 != 0 {
+		return 6
+	}
+	switch a {
+	case Half:
+		return 7
+	case Size:
+	default:
+		return 8
+	}
+	var d = -7 / 2
+	if d != -3 || -7%2 != -1 {
+		return 9
+	}
+	return 0
+}
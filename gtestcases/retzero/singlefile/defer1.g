@@ -0,0 +1,76 @@
+package main
+
+var trace int
+
+// Appends a digit to trace so the order defers ran in can be checked.
+func mark(d int) {
+	trace = trace*10 + d
+}
+
+func early(ret bool) int {
+	defer {
+		mark(1)
+	}
+	defer {
+		mark(2)
+	}
+	if ret {
+		defer {
+			mark(3)
+		}
+		return 5
+	}
+	mark(4)
+	return 6
+}
+
+func loop() {
+	var i int
+	for i = 0; i < 4; i++ {
+		defer {
+			mark(7)
+		}
+		if i == 1 {
+			continue
+		}
+		if i == 2 {
+			break
+		}
+		mark(i)
+	}
+}
+
+func main() int {
+	trace = 0
+	if early(true) != 5 {
+		return 1
+	}
+	if trace != 321 {
+		return 2
+	}
+	trace = 0
+	if early(false) != 6 {
+		return 3
+	}
+	if trace != 421 {
+		return 4
+	}
+	trace = 0
+	loop()
+	if trace != 777 {
+		return 5
+	}
+	trace = 0
+	var x int = 1
+	switch x {
+	case 1:
+		defer {
+			mark(8)
+		}
+		mark(9)
+	}
+	if trace != 98 {
+		return 6
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package main
+
+type Color enum {
+	Red
+	Green
+	Blue
+}
+
+type Dir enum { North, East, South, West }
+
+var favourite Color = Green
+
+func value(c Color) int {
+	switch c {
+	case Red:
+		return 1
+	case Green, Blue:
+		return 2
+	}
+	return 0
+}
+
+func turn(d Dir) Dir {
+	switch d {
+	case North:
+		return East
+	case East:
+		return South
+	case South:
+		return West
+	case West:
+		return North
+	}
+	return d
+}
+
+func main() int {
+	if value(Red) != 1 || value(Blue) != 2 {
+		return 1
+	}
+	if favourite != Green {
+		return 2
+	}
+	var d Dir = North
+	var i int
+	for i = 0; i < 3; i++ {
+		d = turn(d)
+	}
+	if d != West {
+		return 3
+	}
+	switch d {
+	case North:
+		return 4
+	default:
+	}
+	return 0
+}
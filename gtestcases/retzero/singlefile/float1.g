@@ -0,0 +1,64 @@
+package main
+
+const Third = 1.0 / 3
+const Kilo = 1e3
+
+var half float64 = .5
+var quarter float32 = 0x1p-2
+var eighth float32 = 0x.8p-2
+
+func neg(f float64) float64 {
+	return -f
+}
+
+func main() int {
+	var a float64 = 1.5
+	var b = a * 2
+	if b != 3.0 {
+		return 1
+	}
+	if !(a < b) || a >= b || b <= a {
+		return 2
+	}
+	if half+half != 1 {
+		return 3
+	}
+	if float64(quarter) != 0.25 {
+		return 4
+	}
+	if float64(eighth) != 0.125 {
+		return 4
+	}
+	if Kilo != 1000 {
+		return 5
+	}
+	var t float64 = Third * 3
+	if t != 1 {
+		return 6
+	}
+	var f = 7.9
+	if int(f) != 7 {
+		return 7
+	}
+	if int(neg(f)) != -7 {
+		return 8
+	}
+	var i int = 5
+	if float64(i)/2 != 2.5 {
+		return 9
+	}
+	var s float32 = float32(a)
+	if float64(s) != a {
+		return 10
+	}
+	s += 1
+	s *= 2
+	if s != 5 {
+		return 11
+	}
+	var u uint8 = uint8(f)
+	if u != 7 {
+		return 12
+	}
+	return 0
+}
@@ -0,0 +1,13 @@
+package main
+
+var counter int = 5
+
+func bump() {
+    counter += 1
+}
+
+func main() int {
+    bump()
+    bump()
+    return counter - 7
+}
@@ -0,0 +1,18 @@
+package main
+
+type P struct {
+	x int
+	y int
+}
+
+var t (int, int) = 1, 2
+var u = 3, 4.5
+var w (int8, P, *char) = -1, P{5, 6}, "hi"
+
+func main() int {
+	if t[0] != 1 || t[1] != 2 || u[0] != 3 || w[0] != -1 || w[1].y != 6 || w[2][1] != 'i' {
+		return 1
+	}
+	var a, b = t
+	return a + b - 3
+}
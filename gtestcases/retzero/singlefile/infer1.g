@@ -0,0 +1,53 @@
+package main
+
+type s struct {
+	x int
+	y int32
+}
+
+var g = 10
+var gp *int = nil
+
+func two() (int8, int) {
+	return 1, 2
+}
+
+func main() int {
+	var a = 3
+	var b int32 = 4
+	var c = b + 1
+	var v s
+	var p = &v
+	p.x = 5
+	p.y = c
+	if v.x != 5 || v.y != 5 {
+		return 1
+	}
+	var t = two()
+	if t[0] != 1 || t[1] != 2 {
+		return 2
+	}
+	var lit = (a, b)
+	if lit[1] != 4 {
+		return 3
+	}
+	var ok = a == 3
+	if !ok {
+		return 4
+	}
+	var q *int = nil
+	if q != nil || gp != nil {
+		return 5
+	}
+	q = &a
+	var pq = q
+	if *pq != 3 || g != 10 {
+		return 6
+	}
+	var f = two
+	var x, y = f()
+	if x != 1 || y != 2 {
+		return 7
+	}
+	return 0
+}
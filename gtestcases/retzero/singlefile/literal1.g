@@ -0,0 +1,56 @@
+package main
+
+type s struct {
+	x int
+	y int32
+}
+
+type line struct {
+	a s
+	b s
+	n [3]int8
+}
+
+var gs = s{x: 7}
+var gl line = {{1, 2}, {y: 4}, {5, 6}}
+var garr = [4]int{1, 2}
+
+func sum(v s) int {
+	return v.x + 1
+}
+
+func main() int {
+	var v = &s{x: 0, y: 1}
+	if v.x != 0 || v.y != 1 {
+		return 1
+	}
+	var a = s{3}
+	if a.x != 3 || a.y != 0 {
+		return 2
+	}
+	var l = line{a: a, n: {1, 2}}
+	if l.a.x != 3 || l.n[1] != 2 || l.n[2] != 0 || l.b.x != 0 {
+		return 3
+	}
+	var arr = [3]int{1, 2, 3}
+	if arr[0]+arr[1]+arr[2] != 6 {
+		return 4
+	}
+	if gs.x != 7 || gs.y != 0 {
+		return 5
+	}
+	if gl.a.y != 2 || gl.b.y != 4 || gl.n[2] != 0 || gl.n[1] != 6 {
+		return 6
+	}
+	if garr[1] != 2 || garr[3] != 0 {
+		return 7
+	}
+	if sum(s{y: 2, x: 9}) != 10 {
+		return 8
+	}
+	var b s = {1, 2}
+	if b.y != (s{1, 2}).y {
+		return 9
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package main
+
+const Mask = 0xff
+const Perm = 0o755
+const Old = 0755
+const Bits = 0b1010_1010
+const Million = 1_000_000
+const Top uint64 = 0xFFFF_FFFF_FFFF_FFFF
+
+var hex [4]uint8 = {0x0, 0XA, 0x_1f, 'z'}
+
+func main() int {
+	if Mask != 255 {
+		return 1
+	}
+	if Perm != 493 || Old != Perm {
+		return 2
+	}
+	if Bits != 170 || 0B11 != 3 {
+		return 3
+	}
+	if Million != 1000000 {
+		return 4
+	}
+	var t = Top
+	if t != 18446744073709551615 || t>>63 != 1 {
+		return 5
+	}
+	if 'a' != 97 || 'A'+1 != 'B' {
+		return 6
+	}
+	if '\n' != 10 || '\t' != 9 || '\0' != 0 || '\\' != 92 || '\'' != 39 {
+		return 7
+	}
+	if '\x41' != 'A' || '\101' != 'A' || 'é' != 233 || '\u00e9' != 233 {
+		return 8
+	}
+	var c uint8 = 'q'
+	if c != 113 || hex[3] != 122 || hex[2] != 31 {
+		return 9
+	}
+	if 1_5.2_5 != 15.25 {
+		return 10
+	}
+	return 0
+}
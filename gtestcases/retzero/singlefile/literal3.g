@@ -0,0 +1,48 @@
+package main
+
+type s struct {
+	x int
+	y int
+}
+
+// The object outlives the call.
+func make(x int) *s {
+	return &s{x: x, y: x * 2}
+}
+
+// Uses the stack the object would have been in.
+func clobber(a int, b int, c int) int {
+	var arr [8]int
+	var i int
+	for i = 0; i < 8; i++ {
+		arr[i] = a + b + c
+	}
+	return arr[7]
+}
+
+func main() int {
+	var p [4]*s
+	var i int
+	for i = 0; i < 4; i++ {
+		p[i] = &s{x: i}
+	}
+	for i = 0; i < 4; i++ {
+		if p[i].x != i || p[i].y != 0 {
+			return 1
+		}
+	}
+	if p[0] == p[1] {
+		return 2
+	}
+	var q = make(5)
+	clobber(100, 200, 300)
+	var r = make(6)
+	if q.x != 5 || q.y != 10 || r.x != 6 || q == r {
+		return 3
+	}
+	var a = &[3]int{1, 2, 3}
+	if (*a)[2] != 3 {
+		return 4
+	}
+	return 0
+}
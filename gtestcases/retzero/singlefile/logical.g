@@ -0,0 +1,22 @@
+package main
+
+var calls int
+
+func touch() bool {
+    calls += 1
+    return 1 == 1
+}
+
+func main() int {
+    var x int = 1
+    if x == 0 && touch() {
+        return 1
+    }
+    if x == 1 || touch() {
+        x = 2
+    }
+    if !(x != 2) && touch() {
+        x = 3
+    }
+    return x + calls - 4
+}
@@ -0,0 +1,53 @@
+package main
+
+type Pair (int, int)
+
+func divmod(a int, b int) (int, int) {
+	return a / b, a % b
+}
+
+func forward(a int, b int) (int, int) {
+	return divmod(a, b)
+}
+
+func pair(a int) Pair {
+	return a, a + 1
+}
+
+func order(a int, b int) (int, int) {
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
+
+func main() int {
+	var q, r = divmod(17, 5)
+	if q != 3 || r != 2 {
+		return 1
+	}
+	var a, b int
+	a, b = 1, 2
+	a, b = b, a
+	if a != 2 || b != 1 {
+		return 2
+	}
+	q, r = forward(9, 4)
+	if q != 2 || r != 1 {
+		return 3
+	}
+	var lo, hi = order(8, 3)
+	if lo != 3 || hi != 8 {
+		return 4
+	}
+	var x, y = pair(5)
+	if x != 5 || y != 6 {
+		return 5
+	}
+	var p Pair = pair(1)
+	var s, t = p
+	if s != 1 || t != 2 {
+		return 6
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package main
+
+type node struct {
+	val  int
+	next *node
+}
+
+func push(head *node, val int) *node {
+	var n = new node
+	n.val = val
+	n.next = head
+	return n
+}
+
+func main() int {
+	var x = new int
+	if *x != 0 {
+		return 1
+	}
+	*x = 7
+	var arr = new [20]int
+	var i int
+	for i = 0; i < 20; i++ {
+		if (*arr)[i] != 0 {
+			return 2
+		}
+		(*arr)[i] = i * *x
+	}
+	if (*arr)[19] != 133 {
+		return 3
+	}
+	var list *node = nil
+	for i = 1; i <= 3; i++ {
+		list = push(list, i)
+	}
+	if list.val != 3 || list.next.val != 2 || list.next.next.next != nil {
+		return 4
+	}
+	var pp = new *int
+	if *pp != nil {
+		return 5
+	}
+	return 0
+}
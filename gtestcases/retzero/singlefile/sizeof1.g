@@ -0,0 +1,63 @@
+package main
+
+type Foo struct {
+	a int8
+	b int64
+	c int16
+}
+
+type Pair struct {
+	x int32
+	y [3]int8
+	z *Foo
+}
+
+type Mixed union {
+	i int32
+	f float64
+}
+
+const FooSize = sizeof(Foo)
+
+var sizes [4]int = {sizeof(int8), sizeof(Foo), alignof(Foo), offsetof(Foo, c)}
+
+var calls int = 0
+
+func bump() int32 {
+	calls += 1
+	return 1
+}
+
+func main() int {
+	if FooSize != 24 || sizes[1] != 24 || sizes[2] != 8 || sizes[3] != 16 {
+		return 1
+	}
+	if sizeof(int8) != 1 || sizeof(uint16) != 2 || sizeof(float32) != 4 || sizeof(bool) != 1 {
+		return 2
+	}
+	if sizeof(*Foo) != 8 || sizeof(uintptr) != 8 || alignof(*int8) != 8 {
+		return 3
+	}
+	if sizeof([10]int16) != 20 || alignof([10]int16) != 2 {
+		return 4
+	}
+	if offsetof(Pair, x) != 0 || offsetof(Pair, y) != 4 || offsetof(Pair, z) != 8 || sizeof(Pair) != 16 {
+		return 5
+	}
+	if sizeof(Mixed) != 8 || alignof(Mixed) != 8 {
+		return 6
+	}
+	var p Pair
+	if sizeof(p.y) != 3 || sizeof(p) != 16 || sizeof(1) != 8 || sizeof(1.5) != 8 {
+		return 7
+	}
+	var t = (int8(1), int32(2))
+	if sizeof(t) != 8 || sizeof([2]Mixed) != 16 {
+		return 8
+	}
+	var n uint8 = sizeof(Foo)
+	if n != 24 || sizeof(bump()) != 4 || calls != 0 {
+		return 9
+	}
+	return 0
+}
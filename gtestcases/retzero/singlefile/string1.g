@@ -0,0 +1,48 @@
+package main
+
+var greeting *char = "hi\n"
+var names [2]*char = {"ab", "c" "d"}
+
+func length(s *char) int {
+	var n int = 0
+	for s[n] != 0 {
+		n += 1
+	}
+	return n
+}
+
+func main() int {
+	var s = "hello"
+	var t = "hello"
+	if length(s) != 5 || s[0] != 'h' || s[5] != 0 || t[4] != 'o' {
+		return 1
+	}
+	if length(greeting) != 3 || greeting[2] != '\n' {
+		return 2
+	}
+	var esc = "\t\x41\101\"\\é"
+	if length(esc) != 7 || esc[0] != 9 || esc[1] != 'A' || esc[2] != 'A' {
+		return 3
+	}
+	if esc[3] != '"' || esc[4] != '\\' {
+		return 4
+	}
+	var e1 uint8 = uint8(esc[5])
+	var e2 uint8 = uint8(esc[6])
+	if e1 != 0xc3 || e2 != 0xa9 {
+		return 5
+	}
+	if length(names[1]) != 2 || names[1][1] != 'd' {
+		return 6
+	}
+	var x = (1, "foo")
+	var y *char = x[1]
+	if y[2] != 'o' {
+		return 7
+	}
+	var c char = 'z'
+	if length("") != 0 || c != 'z' {
+		return 8
+	}
+	return 0
+}
@@ -0,0 +1,17 @@
+package main
+
+type point struct {
+    x int
+    y int
+}
+
+func sum(p *point) int {
+    return p.x + p.y
+}
+
+func main() int {
+    var p point
+    p.x = 3
+    p.y = 4
+    return sum(&p) - 7
+}
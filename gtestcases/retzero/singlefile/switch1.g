@@ -0,0 +1,66 @@
+package main
+
+func classify(v int) int {
+	var r int
+	switch v {
+	case 0, 1, 2:
+		r = 1
+	case 4..10:
+		r = 2
+		if v == 5 {
+			break
+		}
+		r = 3
+	case 100..200, 3:
+		r = 4
+	default:
+		r = 5
+	}
+	return r
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	}
+	return 0
+}
+
+func main() int {
+	if classify(1) != 1 {
+		return 1
+	}
+	if classify(5) != 2 {
+		return 2
+	}
+	if classify(10) != 3 {
+		return 3
+	}
+	if classify(3) != 4 || classify(150) != 4 {
+		return 4
+	}
+	if classify(11) != 5 || classify(-1) != 5 {
+		return 5
+	}
+	if sign(-4) != -1 || sign(4) != 1 || sign(0) != 0 {
+		return 6
+	}
+	var n int
+	var i int
+	for i = 0; i < 10; i++ {
+		switch i {
+		case 3:
+			continue
+		case 7:
+			n += 100
+		}
+		n += 1
+	}
+	if n != 109 {
+		return 7
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package main
+
+type Lit struct {
+	val int
+}
+
+type Add struct {
+	l *Node
+	r *Node
+}
+
+type Node tunion {
+	lit Lit
+	add Add
+	neg *Node
+}
+
+func eval(n *Node) int {
+	var v Node = *n
+	match v {
+	case lit:
+		return v.val
+	case add:
+		return eval(v.l) + eval(v.r)
+	case neg:
+		return -eval(v)
+	}
+	return 0
+}
+
+func kind(n Node) int {
+	match n {
+	case lit:
+		return 1
+	default:
+		return 2
+	}
+	return 0
+}
+
+func main() int {
+	var a Node
+	var b Node
+	var sum Node
+	var l Lit
+	l.val = 3
+	a.lit = l
+	l.val = 4
+	b.lit = l
+	var add Add
+	add.l = &a
+	add.r = &b
+	sum.add = add
+	if eval(&sum) != 7 {
+		return 1
+	}
+	var n Node
+	n.neg = &sum
+	if eval(&n) != -7 {
+		return 2
+	}
+	if kind(a) != 1 || kind(n) != 2 {
+		return 3
+	}
+	match n {
+	case neg:
+		if n != &sum {
+			return 4
+		}
+		n = &a
+	case lit, add:
+		return 5
+	}
+	if eval(&n) != -3 {
+		return 6
+	}
+	return 0
+}
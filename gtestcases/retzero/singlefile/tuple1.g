@@ -0,0 +1,47 @@
+package main
+
+type Point (int32, int32)
+
+func swap(p (int, int)) (int, int) {
+	return p[1], p[0]
+}
+
+func sum(p Point) int32 {
+	return p[0] + p[1]
+}
+
+func main() int {
+	var x (int, int8) = 1, 2
+	if x[0] != 1 || x[1] != 2 {
+		return 1
+	}
+	x[1] = 5
+	if x[1] != 5 {
+		return 2
+	}
+	var a, b (int, int8) = 3, 4
+	if a != 3 || b != 4 {
+		return 3
+	}
+	var t (int, int) = (7, 8)
+	var c, d = swap(t)
+	if c != 8 || d != 7 {
+		return 4
+	}
+	if swap(t)[0] != 8 {
+		return 5
+	}
+	var p Point = 10, 20
+	if sum(p) != 30 {
+		return 6
+	}
+	var e, f = x
+	if e != 1 || f != 5 {
+		return 7
+	}
+	t = (1, 2)
+	if t[0+1] != 2 {
+		return 8
+	}
+	return 0
+}
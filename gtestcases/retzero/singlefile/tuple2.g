@@ -0,0 +1,53 @@
+package main
+
+// The tuple examples of the README, each in its own function.
+
+func tuple() int {
+	var x = 1,2 // x is a tuple
+	if x[0] != 1 || x[1] != 2 {
+		return 1
+	}
+	return 0
+}
+
+func destructure() int {
+	var x,y = 1,2 // x and y are destructured
+	if x != 1 || y != 2 {
+		return 1
+	}
+	return 0
+}
+
+func explicit() int {
+	var x,y (int,byte) = 1,2 // explicit typing of tuple
+	var b uint8 = y
+	if x != 1 || b != 2 {
+		return 1
+	}
+	return 0
+}
+
+func index() int {
+	var x = (1,"foo")
+	var y = x[1] // y is now type *char
+	if y[0] != 'f' || y[2] != 'o' || y[3] != 0 {
+		return 1
+	}
+	return 0
+}
+
+func main() int {
+	if tuple() != 0 {
+		return 2
+	}
+	if destructure() != 0 {
+		return 3
+	}
+	if explicit() != 0 {
+		return 4
+	}
+	if index() != 0 {
+		return 5
+	}
+	return 0
+}
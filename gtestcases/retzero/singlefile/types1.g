@@ -0,0 +1,32 @@
+package main
+
+var g int = 3 + 4
+
+func addu8(a uint8, b uint8) uint8 {
+	return a + b
+}
+
+func main() int {
+	var x uint8 = 200
+	x = addu8(x, 100)
+	if x != 44 {
+		return 1
+	}
+	var y int32 = -1
+	if y >= 0 {
+		return 2
+	}
+	var z uint32 = 1
+	z = z << 31
+	if z >> 31 != 1 {
+		return 3
+	}
+	if g != 7 {
+		return 4
+	}
+	var b bool = !(g < 3)
+	if !b {
+		return 5
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+package main
+
+type Word union {
+	full uint32
+	bytes [4]uint8
+	half [2]uint16
+}
+
+type Value struct {
+	kind uint8
+	u union {
+		i int64
+		b bool
+	}
+}
+
+func main() int {
+	var w Word
+	w.full = 16909060
+	// Little endian targets store the low byte first.
+	if w.bytes[0] != 4 || w.bytes[3] != 1 {
+		return 1
+	}
+	w.bytes[1] = 0
+	if w.full != 16908292 {
+		return 2
+	}
+	var v Value
+	var p *Value = &v
+	p.u.i = 0
+	p.u.b = true
+	if v.u.i != 1 {
+		return 3
+	}
+	return 0
+}
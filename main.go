@@ -4,16 +4,19 @@ import (
 	"flag"
 	"fmt"
 	"github.com/andrewchambers/g/driver"
+	"github.com/andrewchambers/g/emit"
 	"github.com/andrewchambers/g/parse"
 	"github.com/andrewchambers/g/target"
 	"github.com/andrewchambers/g/util"
 	"io"
 	"os"
+	"runtime"
 	"runtime/pprof"
+	"strings"
 )
 
 func printVersion() {
-	fmt.Println("g version 0.01")
+	fmt.Println("g version " + driver.Version)
 }
 
 func printUsage() {
@@ -24,17 +27,68 @@ func printUsage() {
 	fmt.Println()
 	fmt.Println("Software by Andrew Chambers 2014 - andrewchamberss@gmail.com")
 	fmt.Println()
+	fmt.Println("usage: g [flags] package")
+	fmt.Println()
+	fmt.Print(commandUsage)
+	fmt.Println()
+	fmt.Println("Flags:")
 	flag.PrintDefaults()
 }
 
+// A flag which may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// Print an error to stderr, diagnostics are printed one per line
+// as path:line:col: severity: msg
+func reportError(err error) {
+	formatError(os.Stderr, err)
+}
+
+func formatError(w io.Writer, err error) {
+	switch err := err.(type) {
+	case parse.DiagnosticList:
+		for _, d := range err {
+			fmt.Fprintln(w, d)
+		}
+	case util.ErrorList:
+		for _, e := range err {
+			formatError(w, e)
+		}
+	default:
+		fmt.Fprintln(w, err)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
 	flag.Usage = printUsage
 	tokenizeOnly := flag.Bool("T", false, "Tokenize only (For debugging).")
 	parseOnly := flag.Bool("A", false, "Print AST (For debugging).")
 	doProfiling := flag.Bool("P", false, "Profile the compiler (For debugging).")
 	version := flag.Bool("version", false, "Print version info and exit.")
 	outputPath := flag.String("o", "-", "File to write output to, - for stdout.")
+	allocator := flag.String("allocator", "calloc", "Function called by new, it must behave like calloc.")
+	exportDir := flag.String("exportdir", "", "Directory to write export data of the compiled package to, and to read export data of imports from.")
+	jobs := flag.Int("j", runtime.NumCPU(), "The number of files parsed or packages resolved at once.")
+	var searchPath stringList
+	flag.Var(&searchPath, "I", "Directory searched for imported packages, may be repeated. Defaults to the current directory.")
 	flag.Parse()
+	if len(searchPath) == 0 {
+		searchPath = stringList{"."}
+	}
 
 	if *doProfiling {
 		profile, err := os.Create("ccrun.prof")
@@ -97,20 +151,29 @@ func main() {
 			ast, err = driver.ParseFile(input)
 			astList = []*parse.File{ast}
 		}
+		// Dump whatever could be parsed before reporting errors.
+		for _, ast := range astList {
+			if ast != nil {
+				parse.DebugDump(output, ast)
+			}
+		}
 		if err != nil {
-			fmt.Println(err)
-			fmt.Println("parsing failed.")
+			reportError(err)
+			fmt.Fprintln(os.Stderr, "parsing failed.")
 			os.Exit(1)
 		}
-		for _, ast := range astList {
-			parse.DebugDump(output, ast)
-		}
 	} else {
 		t := target.GetTarget()
-		err := driver.CompilePackageToLLVM(t, input, output)
+		opts := driver.Options{
+			SearchPath: searchPath,
+			ExportDir:  *exportDir,
+			Jobs:       *jobs,
+			Emit:       emit.Options{Allocator: *allocator},
+		}
+		err := driver.CompilePackageToLLVM(t, opts, input, output)
 		if err != nil {
-			fmt.Println(err)
-			fmt.Println("compilation to llvm failed.")
+			reportError(err)
+			fmt.Fprintln(os.Stderr, "compilation to llvm failed.")
 			os.Exit(1)
 		}
 	}
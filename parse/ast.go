@@ -3,6 +3,7 @@ package parse
 import (
 	"fmt"
 	"io"
+	"math/big"
 )
 
 type Node interface {
@@ -33,6 +34,27 @@ type If struct {
 	Els  []Node
 }
 
+// A switch with a nil Expr has boolean case conditions.
+type Switch struct {
+	SpanProvider
+	Expr  Node
+	Cases []*SwitchCase
+}
+
+// A single case clause, the default clause has IsDefault set and no values.
+type SwitchCase struct {
+	SpanProvider
+	IsDefault bool
+	Values    []Node
+	Body      []Node
+}
+
+// A range of case values, inclusive at both ends.
+type CaseRange struct {
+	SpanProvider
+	Low, High Node
+}
+
 type Selector struct {
 	SpanProvider
 	Name string
@@ -62,6 +84,18 @@ type ArrayOf struct {
 	SubType Node
 }
 
+type TupleOf struct {
+	SpanProvider
+	Types []Node
+}
+
+// A comma separated list of expressions. As the left hand side of an
+// assignment each element is assigned to in turn.
+type Tuple struct {
+	SpanProvider
+	Elems []Node
+}
+
 type IndexInto struct {
 	SpanProvider
 	Index Node
@@ -74,6 +108,31 @@ type Struct struct {
 	Types []Node
 }
 
+type Union struct {
+	SpanProvider
+	Names []string
+	Types []Node
+}
+
+// Variants of a tagged union are declared like struct members.
+type TaggedUnion struct {
+	SpanProvider
+	Names []string
+	Types []Node
+}
+
+// The case values of a match are the names of variants.
+type Match struct {
+	SpanProvider
+	Expr  Node
+	Cases []*SwitchCase
+}
+
+type Enum struct {
+	SpanProvider
+	Members []*Ident
+}
+
 type Binop struct {
 	SpanProvider
 	Op   TokenKind
@@ -95,14 +154,35 @@ type Assign struct {
 	L, R Node
 }
 
+// Integer literals are arbitrary precision, they are
+// checked against the type they are given later.
 type Constant struct {
 	SpanProvider
-	Val int64
+	Val *big.Int
+}
+
+// Float literals keep FloatConstantPrec bits of precision, they are
+// rounded when given a float type.
+type FloatConstant struct {
+	SpanProvider
+	Val *big.Float
 }
 
+const FloatConstantPrec = 512
+
+// A composite literal T{a, b} or T{x: a, y: b}. Type is nil for
+// a bare {a, b}, which takes its type from the context it is used in.
+// Named elements are KeyValue nodes.
 type Initializer struct {
 	SpanProvider
-	Sub []Node
+	Type Node
+	Sub  []Node
+}
+
+type KeyValue struct {
+	SpanProvider
+	Key *Ident
+	Val Node
 }
 
 type Ident struct {
@@ -110,6 +190,7 @@ type Ident struct {
 	Val string
 }
 
+// Val holds the decoded bytes of the literal without a terminating NUL.
 type String struct {
 	SpanProvider
 	Val string
@@ -122,15 +203,26 @@ type VarDecl struct {
 	Init *Assign
 }
 
+// var a, b = f() declares a variable for each element of the initializer,
+// which is an Assign to a Tuple of the declared names.
+type MultiVarDecl struct {
+	SpanProvider
+	Decls []*VarDecl
+	Type  Node
+	Init  *Assign
+}
+
 type TypeDecl struct {
 	SpanProvider
 	Name string
 	Type Node
 }
 
+// Type is nil for untyped constants.
 type ConstDecl struct {
 	SpanProvider
 	Name string
+	Type Node
 	Body Node
 }
 
@@ -142,6 +234,28 @@ type FuncDecl struct {
 	ArgNames []string
 	ArgTypes []Node
 	Body     []Node
+	// The closing brace of the body.
+	RBrace FileSpan
+}
+
+// new T allocates a zeroed T on the heap and gives a *T.
+type New struct {
+	SpanProvider
+	Type Node
+}
+
+// A deferred block runs when control leaves the enclosing scope.
+type Defer struct {
+	SpanProvider
+	Body []Node
+}
+
+type Break struct {
+	SpanProvider
+}
+
+type Continue struct {
+	SpanProvider
 }
 
 type Return struct {
@@ -222,6 +336,10 @@ func debugDump(d int, w io.Writer, n Node) {
 		for _, td := range n.TypeDecls {
 			debugDump(d+4, w, td)
 		}
+		p(d+2, "ConstDecls:\n")
+		for _, cd := range n.ConstDecls {
+			debugDump(d+4, w, cd)
+		}
 		p(d+2, "FuncDecls:\n")
 		for _, fd := range n.FuncDecls {
 			debugDump(d+4, w, fd)
@@ -233,6 +351,19 @@ func debugDump(d int, w io.Writer, n Node) {
 		for _, n := range n.Body {
 			debugDump(d+4, w, n)
 		}
+	case *ConstDecl:
+		p(d+0, "ConstDecl:\n")
+		p(d+2, "Name: %s\n", n.Name)
+		if n.Type != nil {
+			p(d+2, "Type:\n")
+			debugDump(d+4, w, n.Type)
+		}
+		p(d+2, "Body:\n")
+		debugDump(d+4, w, n.Body)
+	case *Constant:
+		p(d+0, "Constant: %s\n", n.Val)
+	case *FloatConstant:
+		p(d+0, "FloatConstant: %s\n", n.Val.Text('g', -1))
 	case *TypeDecl:
 		p(d+0, "TypeDecl:\n")
 		p(d+2, "Name:\n")
@@ -256,6 +387,9 @@ func debugDump(d int, w io.Writer, n Node) {
 	case *Unop:
 		p(d+0, "Unop: %s\n", n.Op)
 		debugDump(d+2, w, n.Expr)
+	case *New:
+		p(d+0, "New:\n")
+		debugDump(d+2, w, n.Type)
 	case *Call:
 		p(d+0, "Call:\n")
 	default:
@@ -0,0 +1,86 @@
+package parse
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Diagnostics are the messages the compiler reports about a program.
+// They live in this package so every stage of the compiler can attach
+// a FileSpan to them.
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	}
+	return "unknown"
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Msg      string
+	Span     FileSpan
+}
+
+// Create an error diagnostic at span.
+func Errorf(span FileSpan, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Severity: SeverityError,
+		Msg:      fmt.Sprintf(format, args...),
+		Span:     span,
+	}
+}
+
+// Formats the diagnostic as path:line:col: severity: msg
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s:%s: %s: %s", d.Span.Path, d.Span.Start, d.Severity, d.Msg)
+}
+
+type DiagnosticList []*Diagnostic
+
+func (l DiagnosticList) Error() string {
+	ret := ""
+	for idx := range l {
+		ret += l[idx].Error()
+		if idx != len(l)-1 {
+			ret += "\n"
+		}
+	}
+	return ret
+}
+
+func (l DiagnosticList) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort the diagnostics by their position in the source.
+func (l DiagnosticList) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i].Span, l[j].Span
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Start.Line != b.Start.Line {
+			return a.Start.Line < b.Start.Line
+		}
+		return a.Start.Col < b.Start.Col
+	})
+}
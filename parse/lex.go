@@ -5,6 +5,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // breakout is a dummy type just used for leaving the lexing loop with panic.
@@ -65,7 +69,7 @@ func (l *lexer) currentPos() FilePos {
 
 func isSemiColonInjectToken(k TokenKind) bool {
 	switch k {
-	case IDENTIFIER, CONSTANT, STRING, BREAK, CONTINUE, RETURN, ')', '}':
+	case IDENTIFIER, CONSTANT, FLOATCONSTANT, CHARCONSTANT, STRING, BREAK, CONTINUE, RETURN, INC, DEC, ')', '}', ']':
 		return true
 	}
 	return false
@@ -90,7 +94,7 @@ func (l *lexer) sendTok(k TokenKind, val string) {
 
 // Panics with aborting error type, does not return
 func (l *lexer) lexError(message string) {
-	l.sendTok(ERROR, fmt.Sprintf("Error while lexing: "+message))
+	l.sendTok(ERROR, "Error while lexing: "+message)
 	panic(&breakout{})
 }
 
@@ -153,8 +157,7 @@ func (l *lexer) lex() {
 			l.unreadRune()
 			l.readIdentOrKeyword()
 		case isNumeric(first):
-			l.unreadRune()
-			l.readConstantIntOrFloat()
+			l.readConstantIntOrFloat(first)
 		case isWhiteSpace(first):
 			l.unreadRune()
 			l.skipWhiteSpace()
@@ -172,11 +175,18 @@ func (l *lexer) lex() {
 				l.sendTok(';', ";")
 			case ',':
 				l.sendTok(',', ",")
+			case ':':
+				l.sendTok(':', ":")
 			case '{':
 				l.sendTok('{', "{")
 			case '}':
 				l.sendTok('}', "}")
 			case '.':
+				// .5 is a float.
+				if p := l.peek(1); p != "" && isNumeric(rune(p[0])) {
+					l.readConstantIntOrFloat(first)
+					break
+				}
 				next, _ := l.readRune()
 				switch next {
 				case '.':
@@ -185,9 +195,7 @@ func (l *lexer) lex() {
 						l.sendTok(ELLIPSIS, "...")
 					} else {
 						l.unreadRune()
-						// Parser will pick up obvious error.
-						l.sendTok('.', ".")
-						l.sendTok('.', ".")
+						l.sendTok(DOTDOT, "..")
 					}
 				default:
 					l.unreadRune()
@@ -196,6 +204,9 @@ func (l *lexer) lex() {
 			case '"':
 				l.unreadRune()
 				l.readStringLiteral()
+			case '\'':
+				l.unreadRune()
+				l.readCharLiteral()
 			case '=':
 				next, _ := l.readRune()
 				switch next {
@@ -205,6 +216,15 @@ func (l *lexer) lex() {
 					l.unreadRune()
 					l.sendTok('=', "=")
 				}
+			case '!':
+				next, _ := l.readRune()
+				switch next {
+				case '=':
+					l.sendTok(NEQ, "!=")
+				default:
+					l.unreadRune()
+					l.sendTok('!', "!")
+				}
 			case '|':
 				next, _ := l.readRune()
 				switch next {
@@ -289,7 +309,7 @@ func (l *lexer) lex() {
 				next, _ := l.readRune()
 				switch next {
 				case '=':
-					l.sendTok(MULASSIGN, "+=")
+					l.sendTok(MULASSIGN, "*=")
 				default:
 					l.unreadRune()
 					l.sendTok('*', "*")
@@ -337,6 +357,15 @@ var keywordLUT = map[string]TokenKind{
 	"type":     TYPE,
 	"var":      VAR,
 	"const":    CONST,
+	"switch":   SWITCH,
+	"case":     CASE,
+	"default":  DEFAULT,
+	"enum":     ENUM,
+	"tunion":   TUNION,
+	"match":    MATCH,
+	"union":    UNION,
+	"defer":    DEFER,
+	"new":      NEW,
 }
 
 func (l *lexer) skipUntilBlockCommentTerminator() {
@@ -386,48 +415,301 @@ func (l *lexer) readIdentOrKeyword() {
 	}
 }
 
-// Need to validate these with a regex or another mechanism
-func (l *lexer) readConstantIntOrFloat() {
-	var buff bytes.Buffer
-	l.mark()
-	first, _ := l.readRune()
-	if !isNumeric(first) {
-		panic("internal error")
+// Returns up to the next n bytes without consuming them.
+// Peeking invalidates unreadRune, so lookahead in the number
+// lexer is done with peek only.
+func (l *lexer) peek(n int) string {
+	b, _ := l.brdr.Peek(n)
+	return string(b)
+}
+
+// Consume runes while they are digits or '_' digit separators, returning
+// how many were read. Separators are checked once the whole number is read.
+func (l *lexer) readDigits(buff *bytes.Buffer, isDigit func(rune) bool) int {
+	n := 0
+	for {
+		p := l.peek(1)
+		if p == "" || (!isDigit(rune(p[0])) && p != "_") {
+			return n
+		}
+		r, _ := l.readRune()
+		buff.WriteRune(r)
+		n += 1
 	}
+}
+
+// Reads an integer or float constant, first is the already consumed first
+// rune, a digit or the '.' of a float like .5. Integers may be written with
+// a 0x, 0o or 0b prefix, or in octal with a leading 0 like C. Floats are
+// decimal with an optional e exponent, or hexadecimal with a required p
+// exponent. Digits may be separated with '_'.
+func (l *lexer) readConstantIntOrFloat(first rune) {
+	var buff bytes.Buffer
 	buff.WriteRune(first)
-	for {
-		b, _ := l.readRune()
-		if isHexDigit(b) || b == '.' {
-			buff.WriteRune(b)
-		} else {
-			l.unreadRune()
-			str := buff.String()
-			l.sendTok(CONSTANT, str)
-			break
+	isDigit := isNumeric
+	isHex := false
+	isFloat := first == '.'
+	base := ""
+	if first == '0' {
+		switch l.peek(1) {
+		case "x", "X":
+			isDigit = isHexDigit
+			isHex = true
+			base = "hexadecimal"
+		case "o", "O":
+			isDigit = isOctalDigit
+			base = "octal"
+		case "b", "B":
+			isDigit = isBinaryDigit
+			base = "binary"
+		}
+		if base != "" {
+			r, _ := l.readRune()
+			buff.WriteRune(r)
 		}
 	}
+	nDigits := l.readDigits(&buff, isDigit)
+	if nDigits == 0 && base != "" {
+		// A hexadecimal float may start with its fraction, like 0x.8p1.
+		if p := l.peek(1); p == "" || !(isNumeric(rune(p[0])) || (isHex && p == ".")) {
+			l.lexError(fmt.Sprintf("%s constant has no digits", base))
+		}
+	}
+	// 4..10 is a range, not a malformed float.
+	canBeFloat := base == "" || isHex
+	if canBeFloat && !isFloat && l.peek(1) == "." && l.peek(2) != ".." {
+		r, _ := l.readRune()
+		buff.WriteRune(r)
+		isFloat = true
+		nDigits += l.readDigits(&buff, isDigit)
+		if isHex && nDigits == 0 {
+			l.lexError("hexadecimal constant has no digits")
+		}
+	}
+	exp := "eE"
+	if isHex {
+		exp = "pP"
+	}
+	if p := l.peek(1); canBeFloat && p != "" && strings.Contains(exp, p) {
+		r, _ := l.readRune()
+		buff.WriteRune(r)
+		isFloat = true
+		if p := l.peek(1); p == "+" || p == "-" {
+			r, _ := l.readRune()
+			buff.WriteRune(r)
+		}
+		if l.readDigits(&buff, isNumeric) == 0 {
+			l.lexError("exponent has no digits")
+		}
+	} else if isHex && isFloat {
+		l.lexError("hexadecimal mantissa requires a 'p' exponent")
+	}
+	if p := l.peek(1); p != "" && isValidIdentTail(rune(p[0])) {
+		if base != "" && isNumeric(rune(p[0])) {
+			l.lexError(fmt.Sprintf("invalid digit %q in %s constant", rune(p[0]), base))
+		}
+		l.lexError(fmt.Sprintf("invalid character %q in number", p))
+	}
+	if !validDigitSeparators(buff.String(), isDigit) {
+		l.lexError("'_' must separate successive digits")
+	}
+	// Like C a leading 0 makes an integer octal, but 09.5 is still a float.
+	if s := strings.Replace(buff.String(), "_", "", -1); !isFloat && base == "" && len(s) > 1 && s[0] == '0' {
+		for _, r := range s {
+			if !isOctalDigit(r) {
+				l.lexError(fmt.Sprintf("invalid digit %q in octal constant", r))
+			}
+		}
+	}
+	if isFloat {
+		l.sendTok(FLOATCONSTANT, buff.String())
+	} else {
+		l.sendTok(CONSTANT, buff.String())
+	}
 }
 
-// Need to validate these with a regex or another mechanism
-func (l *lexer) readStringLiteral() {
+// Reports whether every '_' in a number is between two digits, or
+// between a base prefix and a digit.
+func validDigitSeparators(s string, isDigit func(rune) bool) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '_' {
+			continue
+		}
+		if i == 0 || i == len(s)-1 || !isDigit(rune(s[i+1])) {
+			return false
+		}
+		prev := rune(s[i-1])
+		afterPrefix := i == 2 && s[0] == '0' && strings.ContainsRune("xXoObB", prev)
+		if !afterPrefix && !isDigit(prev) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads the text of a literal delimited by quote, including the quotes.
+// A backslash escapes the following rune, escapes are decoded later.
+func (l *lexer) readQuoted(quote rune, what string) string {
 	var buff bytes.Buffer
 	l.mark()
 	first, _ := l.readRune()
-	if first != '"' {
+	if first != quote {
 		panic("internal error")
 	}
 	buff.WriteRune(first)
 	for {
 		b, eof := l.readRune()
-		if eof {
-			l.lexError("eof while reading string literal")
+		if eof || b == '\n' {
+			l.lexError(fmt.Sprintf("unterminated %s literal", what))
 		}
 		buff.WriteRune(b)
-		if b == '"' {
-			break
+		if b == '\\' {
+			next, eof := l.readRune()
+			if eof {
+				l.lexError(fmt.Sprintf("unterminated %s literal", what))
+			}
+			buff.WriteRune(next)
+			continue
+		}
+		if b == quote {
+			return buff.String()
+		}
+	}
+}
+
+// Reads a character literal like 'a' or '\n'. The token keeps the quoted
+// text, the value is decoded again by the parser with charLiteralValue.
+func (l *lexer) readCharLiteral() {
+	lit := l.readQuoted('\'', "character")
+	if _, err := charLiteralValue(lit); err != nil {
+		l.lexError(err.Error())
+	}
+	l.sendTok(CHARCONSTANT, lit)
+}
+
+// Reads a string literal like "a\n". As with character literals the token
+// keeps the quoted text, the parser decodes it with stringLiteralValue.
+func (l *lexer) readStringLiteral() {
+	lit := l.readQuoted('"', "string")
+	if _, err := stringLiteralValue(lit); err != nil {
+		l.lexError(err.Error())
+	}
+	l.sendTok(STRING, lit)
+}
+
+// Decodes a quoted string literal into its bytes. Unicode characters and
+// \u escapes are encoded as utf-8, \x and octal escapes give single bytes.
+func stringLiteralValue(lit string) (string, error) {
+	if len(lit) < 2 || lit[0] != '"' || lit[len(lit)-1] != '"' {
+		return "", fmt.Errorf("malformed string literal %s", lit)
+	}
+	body := lit[1 : len(lit)-1]
+	var buff bytes.Buffer
+	for len(body) != 0 {
+		if body[0] != '\\' {
+			r, size := utf8.DecodeRuneInString(body)
+			if r == utf8.RuneError && size == 1 {
+				return "", fmt.Errorf("invalid utf-8 in string literal")
+			}
+			buff.WriteString(body[:size])
+			body = body[size:]
+			continue
 		}
+		v, n, err := decodeEscape(body)
+		if err != nil {
+			return "", err
+		}
+		if body[1] == 'u' || body[1] == 'U' {
+			buff.WriteRune(rune(v))
+		} else {
+			buff.WriteByte(byte(v))
+		}
+		body = body[n:]
 	}
-	l.sendTok(STRING, buff.String())
+	return buff.String(), nil
+}
+
+// Decodes a quoted character literal. The value is the unicode code point
+// of the character, or the value given by a C escape sequence.
+func charLiteralValue(lit string) (uint32, error) {
+	if len(lit) < 2 || lit[0] != '\'' || lit[len(lit)-1] != '\'' {
+		return 0, fmt.Errorf("malformed character literal %s", lit)
+	}
+	body := lit[1 : len(lit)-1]
+	if body == "" {
+		return 0, fmt.Errorf("empty character literal")
+	}
+	var v uint32
+	var n int
+	if body[0] == '\\' {
+		var err error
+		v, n, err = decodeEscape(body)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		r, size := utf8.DecodeRuneInString(body)
+		if r == utf8.RuneError && size == 1 {
+			return 0, fmt.Errorf("invalid utf-8 in character literal")
+		}
+		v, n = uint32(r), size
+	}
+	if n != len(body) {
+		return 0, fmt.Errorf("more than one character in character literal")
+	}
+	return v, nil
+}
+
+// Decodes the C escape sequence at the start of s, returning its value
+// and how many bytes it used. \u and \U give a unicode code point.
+func decodeEscape(s string) (uint32, int, error) {
+	if len(s) < 2 || s[0] != '\\' {
+		return 0, 0, fmt.Errorf("malformed escape sequence")
+	}
+	switch c := s[1]; c {
+	case 'a':
+		return '\a', 2, nil
+	case 'b':
+		return '\b', 2, nil
+	case 'f':
+		return '\f', 2, nil
+	case 'n':
+		return '\n', 2, nil
+	case 'r':
+		return '\r', 2, nil
+	case 't':
+		return '\t', 2, nil
+	case 'v':
+		return '\v', 2, nil
+	case '\\', '?', '\'', '"':
+		return uint32(c), 2, nil
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		// Up to three octal digits like C.
+		n := 1
+		v := uint32(0)
+		for n < 4 && n < len(s) && isOctalDigit(rune(s[n])) {
+			v = v*8 + uint32(s[n]-'0')
+			n += 1
+		}
+		if v > 255 {
+			return 0, 0, fmt.Errorf("octal escape value %d > 255", v)
+		}
+		return v, n, nil
+	case 'x', 'u', 'U':
+		digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+		if len(s) < 2+digits {
+			return 0, 0, fmt.Errorf("escape sequence \\%c requires %d hexadecimal digits", c, digits)
+		}
+		v, err := strconv.ParseUint(s[2:2+digits], 16, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("escape sequence \\%c requires %d hexadecimal digits", c, digits)
+		}
+		if c != 'x' && (v > unicode.MaxRune || (v >= 0xD800 && v < 0xE000)) {
+			return 0, 0, fmt.Errorf("escape sequence is an invalid unicode code point")
+		}
+		return uint32(v), 2 + digits, nil
+	}
+	return 0, 0, fmt.Errorf("unknown escape sequence %q", s[:2])
 }
 
 func (l *lexer) maybeDoSemiHack() {
@@ -479,6 +761,14 @@ func isNumeric(b rune) bool {
 	return false
 }
 
+func isOctalDigit(b rune) bool {
+	return b >= '0' && b <= '7'
+}
+
+func isBinaryDigit(b rune) bool {
+	return b == '0' || b == '1'
+}
+
 func isHexDigit(b rune) bool {
 	return isNumeric(b) || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
 }
@@ -0,0 +1,141 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+// Lexes src and returns its first token.
+func lexFirst(src string) *Token {
+	tokChan, cancel := Lex("lex.g", strings.NewReader(src))
+	tok := <-tokChan
+	cancel <- struct{}{}
+	return tok
+}
+
+type lexCase struct {
+	src  string
+	kind TokenKind
+	// The token text, or for an ERROR the message without its prefix.
+	val string
+}
+
+func checkLexCases(t *testing.T, cases []lexCase) {
+	for _, c := range cases {
+		tok := lexFirst(c.src)
+		if tok == nil {
+			t.Errorf("%s: no tokens", c.src)
+			continue
+		}
+		val := strings.TrimPrefix(tok.Val, "Error while lexing: ")
+		if tok.Kind != c.kind || val != c.val {
+			t.Errorf("%s: got %s %q, expected %s %q", c.src, tok.Kind, val, c.kind, c.val)
+		}
+	}
+}
+
+func TestLexFloats(t *testing.T) {
+	checkLexCases(t, []lexCase{
+		{"1.5", FLOATCONSTANT, "1.5"},
+		{"1.", FLOATCONSTANT, "1."},
+		{"1e10", FLOATCONSTANT, "1e10"},
+		{"1E-3", FLOATCONSTANT, "1E-3"},
+		{"09.5", FLOATCONSTANT, "09.5"},
+		{"1_000.5", FLOATCONSTANT, "1_000.5"},
+		{"0x1p4", FLOATCONSTANT, "0x1p4"},
+		{"0x1.8p-1", FLOATCONSTANT, "0x1.8p-1"},
+		{"0x.8p1", FLOATCONSTANT, "0x.8p1"},
+		{"1e", ERROR, "exponent has no digits"},
+		{"1e+", ERROR, "exponent has no digits"},
+		{"1.5e-x", ERROR, "exponent has no digits"},
+		{"0x1p", ERROR, "exponent has no digits"},
+		{"0x1.0", ERROR, "hexadecimal mantissa requires a 'p' exponent"},
+		{"0x.8", ERROR, "hexadecimal mantissa requires a 'p' exponent"},
+		{"0x.p1", ERROR, "hexadecimal constant has no digits"},
+		{"1.5x", ERROR, "invalid character \"x\" in number"},
+		{"1_.5", ERROR, "'_' must separate successive digits"},
+		{"1._5", ERROR, "'_' must separate successive digits"},
+	})
+}
+
+func TestLexIntegers(t *testing.T) {
+	checkLexCases(t, []lexCase{
+		{"0", CONSTANT, "0"},
+		{"1_000", CONSTANT, "1_000"},
+		{"0x_ff", CONSTANT, "0x_ff"},
+		{"0XFF", CONSTANT, "0XFF"},
+		{"0o17", CONSTANT, "0o17"},
+		{"017", CONSTANT, "017"},
+		{"0b1010", CONSTANT, "0b1010"},
+		{"0x", ERROR, "hexadecimal constant has no digits"},
+		{"0o", ERROR, "octal constant has no digits"},
+		{"0b", ERROR, "binary constant has no digits"},
+		{"0b2", ERROR, "invalid digit '2' in binary constant"},
+		{"0o8", ERROR, "invalid digit '8' in octal constant"},
+		{"09", ERROR, "invalid digit '9' in octal constant"},
+		{"0_8", ERROR, "invalid digit '8' in octal constant"},
+		{"1__0", ERROR, "'_' must separate successive digits"},
+		{"1_", ERROR, "'_' must separate successive digits"},
+		{"0x__1", ERROR, "'_' must separate successive digits"},
+		{"0xfg", ERROR, "invalid character \"g\" in number"},
+		{"12abc", ERROR, "invalid character \"a\" in number"},
+	})
+}
+
+func TestLexCharacters(t *testing.T) {
+	checkLexCases(t, []lexCase{
+		{"'a'", CHARCONSTANT, "'a'"},
+		{"'\\n'", CHARCONSTANT, "'\\n'"},
+		{"'\\''", CHARCONSTANT, "'\\''"},
+		{"'\\x41'", CHARCONSTANT, "'\\x41'"},
+		{"'\\101'", CHARCONSTANT, "'\\101'"},
+		{"'\\u00e9'", CHARCONSTANT, "'\\u00e9'"},
+		{"'é'", CHARCONSTANT, "'é'"},
+		{"''", ERROR, "empty character literal"},
+		{"'ab'", ERROR, "more than one character in character literal"},
+		{"'\\q'", ERROR, "unknown escape sequence \"\\\\q\""},
+		{"'\\x4'", ERROR, "escape sequence \\x requires 2 hexadecimal digits"},
+		{"'\\xZZ'", ERROR, "escape sequence \\x requires 2 hexadecimal digits"},
+		{"'\\400'", ERROR, "octal escape value 256 > 255"},
+		{"'\\uD800'", ERROR, "escape sequence is an invalid unicode code point"},
+		{"'a", ERROR, "unterminated character literal"},
+		{"'a\n'", ERROR, "unterminated character literal"},
+		{"'\\", ERROR, "unterminated character literal"},
+	})
+}
+
+func TestLexStrings(t *testing.T) {
+	checkLexCases(t, []lexCase{
+		{`""`, STRING, `""`},
+		{`"a\tb\n"`, STRING, `"a\tb\n"`},
+		{`"\"quoted\""`, STRING, `"\"quoted\""`},
+		{`"\x41\101é"`, STRING, `"\x41\101é"`},
+		{`"é"`, STRING, `"é"`},
+		{`"\xZ"`, ERROR, `escape sequence \x requires 2 hexadecimal digits`},
+		{`"\q"`, ERROR, `unknown escape sequence "\\q"`},
+		{`"\U00110000"`, ERROR, "escape sequence is an invalid unicode code point"},
+		{`"\777"`, ERROR, "octal escape value 511 > 255"},
+		{`"abc`, ERROR, "unterminated string literal"},
+		{"\"abc\ndef\"", ERROR, "unterminated string literal"},
+		{`"abc\"`, ERROR, "unterminated string literal"},
+	})
+}
+
+func TestStringLiteralValue(t *testing.T) {
+	cases := []struct {
+		lit string
+		val string
+	}{
+		{`""`, ""},
+		{`"a\tb\n"`, "a\tb\n"},
+		{`"\x41\101\0"`, "AA\x00"},
+		{`"éé"`, "éé"},
+		{`"\xff"`, "\xff"},
+	}
+	for _, c := range cases {
+		v, err := stringLiteralValue(c.lit)
+		if err != nil || v != c.val {
+			t.Errorf("%s: got %q %v, expected %q", c.lit, v, err, c.val)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package parse
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
 )
 
@@ -10,9 +11,17 @@ type parser struct {
 	nextTok *Token
 	c       <-chan *Token
 	ast     *File
-	err     error
+	diags   DiagnosticList
+	// Set while parsing the header of an if, for, switch or match, where
+	// a '{' after a type name starts the body, not a composite literal.
+	noCompositeLit bool
+	// The number of diagnostics when the current function body started.
+	bodyDiags int
 }
 
+// Parse a file from a token stream. On syntax errors the parser skips to the
+// next statement or top level declaration and continues, so the returned File
+// may be partial. The error is a DiagnosticList of all syntax errors found.
 func Parse(c <-chan *Token) (*File, error) {
 	//Read channel until empty incase of errors
 	defer func() {
@@ -27,27 +36,44 @@ func Parse(c <-chan *Token) (*File, error) {
 	p.next()
 	p.next()
 	p.parseFile()
-	return p.ast, p.err
+	if len(p.diags) != 0 {
+		return p.ast, p.diags
+	}
+	return p.ast, nil
+}
+
+func (p *parser) addError(message string, span FileSpan) {
+	// Errors cascading from the same position are not useful.
+	if len(p.diags) != 0 && p.diags[len(p.diags)-1].Span.Start == span.Start {
+		return
+	}
+	p.diags = append(p.diags, Errorf(span, "%s", message))
 }
 
-// Panics with aborting error type, does not return
+// Panics with aborting error type, does not return.
+// The panic is recovered at the next statement or top level declaration.
 func (p *parser) syntaxError(message string, span FileSpan) {
-	p.err = fmt.Errorf("%s at %s:%d:%d", message, span.Path, span.Start.Line, span.Start.Col)
+	p.addError(message, span)
 	panic(&breakout{})
 }
 
 func (p *parser) next() {
-	// Lex error occured
-	if p.nextTok != nil && p.nextTok.Kind == ERROR {
-		p.syntaxError(p.nextTok.Val, p.nextTok.Span)
-	}
 	p.curTok = p.nextTok
 	p.nextTok = <-p.c
 	//On eof insert an EOF token
 	if p.nextTok == nil {
-		p.nextTok = &Token{EOF, "", p.curTok.Span}
+		var span FileSpan
+		if p.curTok != nil {
+			span = p.curTok.Span
+		}
+		p.nextTok = &Token{EOF, "", span}
 		p.nextTok.Span.Start = p.nextTok.Span.End
 	}
+	// The lexer stops after an error, so the error is treated as the end of the file.
+	if p.nextTok.Kind == ERROR {
+		p.addError(p.nextTok.Val, p.nextTok.Span)
+		p.nextTok = &Token{EOF, "", p.nextTok.Span}
+	}
 }
 
 func (p *parser) expect(k TokenKind) {
@@ -57,21 +83,80 @@ func (p *parser) expect(k TokenKind) {
 	p.next()
 }
 
-func (p *parser) parseFile() {
+// Run f, recovering from any syntax error by skipping to the
+// next top level declaration.
+func (p *parser) recoverTopLevel(f func()) {
 	defer func() {
 		if e := recover(); e != nil {
 			_ = e.(*breakout) // Will re-panic if not a breakout.
+			p.syncTopLevel()
 		}
-
 	}()
+	f()
+}
+
+// Skip tokens until the start of a top level declaration.
+func (p *parser) syncTopLevel() {
+	depth := 0
+	for p.curTok.Kind != EOF {
+		switch p.curTok.Kind {
+		case FUNC, TYPE, VAR, CONST:
+			if depth <= 0 {
+				return
+			}
+		case '{':
+			depth += 1
+		case '}':
+			depth -= 1
+		}
+		p.next()
+	}
+}
+
+// Skip tokens until the start of the next statement, or a top level
+// declaration which ends the function body.
+func (p *parser) syncStatement() {
+	depth := 0
+	for {
+		switch p.curTok.Kind {
+		case EOF, FUNC, TYPE, CONST:
+			return
+		case VAR:
+			if depth == 0 {
+				return
+			}
+		case ';':
+			if depth == 0 {
+				p.next()
+				return
+			}
+		case CASE, DEFAULT:
+			if depth == 0 {
+				return
+			}
+		case '{':
+			depth += 1
+		case '}':
+			if depth == 0 {
+				return
+			}
+			depth -= 1
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseFile() {
 	p.ast = &File{}
-	p.expect(PACKAGE)
-	//This span is bogus, but a File is just the whole file.
-	p.ast.Span = p.curTok.Span
-	p.ast.Pkg = p.curTok.Val
-	p.expect(IDENTIFIER)
-	p.expect(';')
-	p.parseImportList()
+	p.recoverTopLevel(func() {
+		p.expect(PACKAGE)
+		//This span is bogus, but a File is just the whole file.
+		p.ast.Span = p.curTok.Span
+		p.ast.Pkg = p.curTok.Val
+		p.expect(IDENTIFIER)
+		p.expect(';')
+		p.parseImportList()
+	})
 	p.parseTopLevelDeclarations()
 }
 
@@ -81,8 +166,18 @@ func (p *parser) parseImportList() {
 		switch p.curTok.Kind {
 		case '(':
 			p.next()
-			for p.curTok.Kind == STRING {
+			for p.curTok.Kind != ')' && p.curTok.Kind != EOF {
+				if p.curTok.Kind == ';' {
+					p.next()
+					continue
+				}
+				if p.curTok.Kind != STRING {
+					p.syntaxError("expected import path", p.curTok.Span)
+				}
 				p.ast.addImport(p.parseString())
+				if p.curTok.Kind != ')' {
+					p.expect(';')
+				}
 			}
 			p.expect(')')
 		case STRING:
@@ -90,61 +185,144 @@ func (p *parser) parseImportList() {
 		default:
 			p.syntaxError("expected string literal or '('", p.curTok.Span)
 		}
+		p.expect(';')
 	}
 }
 
+// Adjacent string literals are concatenated like C.
 func (p *parser) parseString() *String {
 	ret := &String{}
 	ret.Span = p.curTok.Span
-	ret.Val = p.curTok.Val
-	p.expect(STRING)
-	return ret
+	for {
+		v, err := stringLiteralValue(p.curTok.Val)
+		if err != nil {
+			p.syntaxError(err.Error(), p.curTok.Span)
+		}
+		ret.Val += v
+		ret.Span.End = p.curTok.Span.End
+		p.expect(STRING)
+		if p.curTok.Kind != STRING {
+			return ret
+		}
+	}
 }
 
 func (p *parser) parseTopLevelDeclarations() {
 	for p.curTok.Kind != EOF {
-		switch p.curTok.Kind {
-		case TYPE:
-			t := p.parseTypeDecl()
-			p.ast.addTypeDecl(t)
-		case FUNC:
-			f := p.parseFuncDecl()
-			p.ast.addFuncDecl(f)
-		case VAR:
-			v := p.parseVarDecl()
-			p.ast.addVarDecl(v)
-		case CONST:
-			p.parseConst()
-		default:
-			p.syntaxError(fmt.Sprintf("expected var, type, const or func got %s", p.curTok.Kind), p.curTok.Span)
+		p.recoverTopLevel(p.parseTopLevelDeclaration)
+	}
+}
+
+func (p *parser) parseTopLevelDeclaration() {
+	switch p.curTok.Kind {
+	case TYPE:
+		t := p.parseTypeDecl()
+		p.ast.addTypeDecl(t)
+	case FUNC:
+		p.parseFuncDecl()
+	case VAR:
+		v := p.parseVarDecl()
+		vd, ok := v.(*VarDecl)
+		if !ok {
+			p.syntaxError("package level var declarations must declare a single name", v.GetSpan())
 		}
-		p.expect(';')
+		p.ast.addVarDecl(vd)
+	case CONST:
+		p.parseConst()
+	default:
+		p.syntaxError(fmt.Sprintf("expected var, type, const or func got %s", p.curTok.Kind), p.curTok.Span)
 	}
+	p.expect(';')
 }
 
-func (p *parser) parseVarDecl() *VarDecl {
-	ret := &VarDecl{}
-	ret.Span = p.curTok.Span
+// Returns a VarDecl, or a MultiVarDecl if more than one name is declared.
+func (p *parser) parseVarDecl() Node {
+	span := p.curTok.Span
 	p.expect(VAR)
-	ret.Name = p.curTok.Val
-	ident := &Ident{}
-	ident.Span = p.curTok.Span
-	ident.Val = p.curTok.Val
-	p.expect(IDENTIFIER)
-	ret.Type = p.parseType(false)
+	var idents []Node
+	for {
+		ident := &Ident{}
+		ident.Span = p.curTok.Span
+		ident.Val = p.curTok.Val
+		p.expect(IDENTIFIER)
+		idents = append(idents, ident)
+		if p.curTok.Kind != ',' {
+			break
+		}
+		p.next()
+	}
+	var t Node
+	// Without a type, the type is inferred from the initializer.
+	if p.curTok.Kind != '=' {
+		t = p.parseType(false)
+	}
+	var init *Assign
 	if p.curTok.Kind == '=' {
 		p.next()
-		r := p.parseExpression()
-		ret.Init = &Assign{}
-		ret.Init.Op = '='
-		ret.Init.R = r
-		ret.Init.L = ident
-		ret.Init.Span = ident.Span
-		ret.Init.Span.End = r.GetSpan().End
+		init = &Assign{}
+		init.Op = '='
+		init.R = p.parseExpressionList()
+		init.L = idents[0]
+		if len(idents) != 1 {
+			init.L = newTuple(idents)
+		}
+		init.Span = init.L.GetSpan()
+		init.Span.End = init.R.GetSpan().End
 	}
+	if len(idents) == 1 {
+		ret := &VarDecl{}
+		ret.Span = span
+		ret.Name = idents[0].(*Ident).Val
+		ret.Type = t
+		ret.Init = init
+		return ret
+	}
+	ret := &MultiVarDecl{}
+	ret.Span = span
+	ret.Type = t
+	ret.Init = init
+	for _, ident := range idents {
+		vd := &VarDecl{}
+		vd.Span = ident.GetSpan()
+		vd.Name = ident.(*Ident).Val
+		ret.Decls = append(ret.Decls, vd)
+	}
+	return ret
+}
+
+func newTuple(elems []Node) *Tuple {
+	ret := &Tuple{}
+	ret.Elems = elems
+	ret.Span = elems[0].GetSpan()
+	ret.Span.End = elems[len(elems)-1].GetSpan().End
 	return ret
 }
 
+// Run parse with composite literals allowed or disallowed.
+func (p *parser) withCompositeLits(allow bool, parse func() Node) Node {
+	old := p.noCompositeLit
+	p.noCompositeLit = !allow
+	defer func() {
+		p.noCompositeLit = old
+	}()
+	return parse()
+}
+
+// Parses a comma separated list of expressions as a Tuple,
+// a single expression is returned as is.
+func (p *parser) parseExpressionList() Node {
+	first := p.parseExpression()
+	if p.curTok.Kind != ',' {
+		return first
+	}
+	elems := []Node{first}
+	for p.curTok.Kind == ',' {
+		p.next()
+		elems = append(elems, p.parseExpression())
+	}
+	return newTuple(elems)
+}
+
 func (p *parser) parseTypeDecl() *TypeDecl {
 	ret := &TypeDecl{}
 	ret.Span = p.curTok.Span
@@ -155,8 +333,11 @@ func (p *parser) parseTypeDecl() *TypeDecl {
 	return ret
 }
 
-func (p *parser) parseFuncDecl() *FuncDecl {
+// The declaration is added to the file once its header is parsed, so a
+// syntax error in the body leaves it with the statements which parsed.
+func (p *parser) parseFuncDecl() {
 	ret := &FuncDecl{}
+	ret.Span = p.curTok.Span
 	p.expect(FUNC)
 	ret.Name = p.curTok.Val
 	p.expect(IDENTIFIER)
@@ -165,9 +346,11 @@ func (p *parser) parseFuncDecl() *FuncDecl {
 	p.expect(')')
 	ret.RetType = p.parseType(true)
 	p.expect('{')
+	p.ast.addFuncDecl(ret)
+	p.bodyDiags = len(p.diags)
 	p.parseStatementList(&ret.Body)
-	p.expect('}')
-	return ret
+	ret.RBrace = p.curTok.Span
+	p.expectBlockEnd()
 }
 
 func (p *parser) parseType(allowEmpty bool) Node {
@@ -175,6 +358,7 @@ func (p *parser) parseType(allowEmpty bool) Node {
 	switch p.curTok.Kind {
 	case '[':
 		ret := &ArrayOf{}
+		ret.Span = p.curTok.Span
 		p.expect('[')
 		if p.curTok.Kind != CONSTANT {
 			//Trigger syntax error
@@ -192,15 +376,22 @@ func (p *parser) parseType(allowEmpty bool) Node {
 		p.expect(']')
 		t := p.parseType(false)
 		ret.SubType = t
+		ret.Span.End = t.GetSpan().End
 		return ret
 	case STRUCT:
 		return p.parseStruct()
+	case UNION:
+		return p.parseUnion()
+	case ENUM:
+		return p.parseEnum()
+	case TUNION:
+		return p.parseTaggedUnion()
 	case IDENTIFIER:
 		ret := &Ident{}
 		ret.Span = p.curTok.Span
 		ret.Val = p.curTok.Val
 		p.next()
-		return ret
+		return p.parseQualifiedType(ret)
 	case '*':
 		ret := &PointerTo{}
 		ret.Span = p.curTok.Span
@@ -209,6 +400,22 @@ func (p *parser) parseType(allowEmpty bool) Node {
 		ret.PointsTo = pointsTo
 		ret.Span.End = pointsTo.GetSpan().End
 		return ret
+	case '(':
+		ret := &TupleOf{}
+		ret.Span = p.curTok.Span
+		p.next()
+		ret.Types = append(ret.Types, p.parseType(false))
+		for p.curTok.Kind == ',' {
+			p.next()
+			ret.Types = append(ret.Types, p.parseType(false))
+		}
+		ret.Span.End = p.curTok.Span.End
+		p.expect(')')
+		// (T) is just T.
+		if len(ret.Types) == 1 {
+			return ret.Types[0]
+		}
+		return ret
 	default:
 		if allowEmpty {
 			return nil
@@ -218,13 +425,21 @@ func (p *parser) parseType(allowEmpty bool) Node {
 	return nil
 }
 
+// A type name may be qualified by a package name, pkg.T is a Selector.
+func (p *parser) parseQualifiedType(name *Ident) Node {
+	if p.curTok.Kind != '.' {
+		return name
+	}
+	return p.parseSelector(name)
+}
+
 func (p *parser) parseArgList(f *FuncDecl) {
 loop:
 	for {
 		name := ""
 		var t Node
 		switch p.curTok.Kind {
-		case '*', '[', STRUCT, FUNC:
+		case '*', '[', STRUCT, UNION, FUNC:
 			t = p.parseType(false)
 		case IDENTIFIER:
 			// Either its the var name, or a type alias.
@@ -234,10 +449,14 @@ loop:
 			ta.Span = p.curTok.Span
 			ta.Val = p.curTok.Val
 			p.next()
-			if p.curTok.Kind == ',' {
+			switch p.curTok.Kind {
+			case ',':
 				name = ""
 				t = ta
-			} else {
+			case '.':
+				name = ""
+				t = p.parseQualifiedType(ta)
+			default:
 				t = p.parseType(false)
 			}
 		default:
@@ -256,17 +475,84 @@ loop:
 	}
 }
 
+// Parses a const declaration or a parenthesized group of them.
 func (p *parser) parseConst() {
 	p.expect(CONST)
+	if p.curTok.Kind != '(' {
+		p.ast.addConstDecl(p.parseConstSpec())
+		return
+	}
+	p.expect('(')
+	for p.curTok.Kind != ')' && p.curTok.Kind != EOF {
+		if p.curTok.Kind == ';' {
+			p.next()
+			continue
+		}
+		p.ast.addConstDecl(p.parseConstSpec())
+		if p.curTok.Kind != ')' {
+			p.expect(';')
+		}
+	}
+	p.expect(')')
 }
 
+func (p *parser) parseConstSpec() *ConstDecl {
+	ret := &ConstDecl{}
+	ret.Span = p.curTok.Span
+	ret.Name = p.curTok.Val
+	p.expect(IDENTIFIER)
+	if p.curTok.Kind != '=' {
+		ret.Type = p.parseType(false)
+	}
+	p.expect('=')
+	ret.Body = p.parseExpression()
+	ret.Span.End = ret.Body.GetSpan().End
+	return ret
+}
+
+// Statement lists end at a closing brace or the next switch case, or at
+// a top level declaration if the closing brace is missing.
 func (p *parser) parseStatementList(sl *[]Node) {
-	for p.curTok.Kind != '}' && p.curTok.Kind != EOF {
-		s := p.parseStatement()
-		*sl = append(*sl, s)
+	for p.curTok.Kind != '}' && p.curTok.Kind != CASE && p.curTok.Kind != DEFAULT && !p.atTopLevelDecl() {
+		s := p.parseStatementOrSync()
+		if s != nil {
+			*sl = append(*sl, s)
+		}
 	}
 }
 
+// Reports whether the current token can only start a top level declaration.
+// var is not one of them, it also starts a statement.
+func (p *parser) atTopLevelDecl() bool {
+	switch p.curTok.Kind {
+	case EOF, FUNC, TYPE, CONST:
+		return true
+	}
+	return false
+}
+
+// Expect the '}' closing a block of statements. When a function body runs
+// into the next declaration after a syntax error in it, the error most
+// likely hid the brace, so no further error is reported.
+func (p *parser) expectBlockEnd() {
+	if p.curTok.Kind != '}' && p.atTopLevelDecl() && len(p.diags) != p.bodyDiags {
+		panic(&breakout{})
+	}
+	p.expect('}')
+}
+
+// Parse a statement, returning nil if the statement has a syntax error.
+func (p *parser) parseStatementOrSync() (ret Node) {
+	defer func() {
+		if e := recover(); e != nil {
+			_ = e.(*breakout) // Will re-panic if not a breakout.
+			ret = nil
+			p.syncStatement()
+		}
+	}()
+	return p.parseStatement()
+}
+
 func (p *parser) parseStatement() Node {
 	switch p.curTok.Kind {
 	case RETURN:
@@ -278,7 +564,7 @@ func (p *parser) parseStatement() Node {
 			r.Expr = nil
 			return r
 		}
-		r.Expr = p.parseExpression()
+		r.Expr = p.parseExpressionList()
 		r.Span.End = p.curTok.Span.End
 		p.expect(';')
 		return r
@@ -292,6 +578,33 @@ func (p *parser) parseStatement() Node {
 	case IF:
 		ret := p.parseIf()
 		return ret
+	case SWITCH:
+		ret := p.parseSwitch()
+		return ret
+	case MATCH:
+		ret := p.parseMatch()
+		return ret
+	case DEFER:
+		ret := &Defer{}
+		ret.Span = p.curTok.Span
+		p.next()
+		p.expect('{')
+		p.parseStatementList(&ret.Body)
+		ret.Span.End = p.curTok.Span.End
+		p.expectBlockEnd()
+		return ret
+	case BREAK:
+		ret := &Break{}
+		ret.Span = p.curTok.Span
+		p.next()
+		p.expect(';')
+		return ret
+	case CONTINUE:
+		ret := &Continue{}
+		ret.Span = p.curTok.Span
+		p.next()
+		p.expect(';')
+		return ret
 	default:
 		ret := p.parseSimpleStatement()
 		p.expect(';')
@@ -315,26 +628,93 @@ func (p *parser) parseStruct() Node {
 	return ret
 }
 
+func (p *parser) parseUnion() Node {
+	ret := &Union{}
+	ret.Span = p.curTok.Span
+	p.expect(UNION)
+	p.expect('{')
+	for p.curTok.Kind == IDENTIFIER {
+		ret.Names = append(ret.Names, p.curTok.Val)
+		p.next()
+		ret.Types = append(ret.Types, p.parseType(false))
+		p.expect(';')
+	}
+	ret.Span.End = p.curTok.Span.End
+	p.expect('}')
+	return ret
+}
+
+func (p *parser) parseTaggedUnion() Node {
+	ret := &TaggedUnion{}
+	ret.Span = p.curTok.Span
+	p.expect(TUNION)
+	p.expect('{')
+	for p.curTok.Kind == IDENTIFIER {
+		ret.Names = append(ret.Names, p.curTok.Val)
+		p.next()
+		ret.Types = append(ret.Types, p.parseType(false))
+		p.expect(';')
+	}
+	ret.Span.End = p.curTok.Span.End
+	p.expect('}')
+	return ret
+}
+
+// Enum members are separated by newlines, commas or just spaces.
+func (p *parser) parseEnum() Node {
+	ret := &Enum{}
+	ret.Span = p.curTok.Span
+	p.expect(ENUM)
+	p.expect('{')
+	for p.curTok.Kind == IDENTIFIER {
+		m := &Ident{}
+		m.Span = p.curTok.Span
+		m.Val = p.curTok.Val
+		ret.Members = append(ret.Members, m)
+		p.next()
+		if p.curTok.Kind == ';' || p.curTok.Kind == ',' {
+			p.next()
+		}
+	}
+	ret.Span.End = p.curTok.Span.End
+	p.expect('}')
+	return ret
+}
+
 func (p *parser) parseSimpleStatement() Node {
 	if p.curTok.Kind == ';' {
 		ret := &EmptyStatement{}
 		ret.Span = p.curTok.Span
 		return ret
 	}
-	ret := p.parseExpression()
+	ret := p.parseExpressionList()
 	switch p.curTok.Kind {
-	case '=', ADDASSIGN, MULASSIGN:
+	case '=', ADDASSIGN, SUBASSIGN, MULASSIGN, ANDASSIGN, ORASSIGN, XORASSIGN:
 		ass := &Assign{}
 		ass.Op = p.curTok.Kind
 		ass.L = ret
 		p.next()
-		r := p.parseExpression()
+		r := p.parseExpressionList()
 		ass.R = r
 		ass.Span = ass.L.GetSpan()
 		ass.Span.End = ass.R.GetSpan().End
 		ret = ass
 	case INC, DEC:
+		// x++ is treated as x += 1.
+		ass := &Assign{}
+		ass.Op = ADDASSIGN
+		if p.curTok.Kind == DEC {
+			ass.Op = SUBASSIGN
+		}
+		one := &Constant{}
+		one.Val = big.NewInt(1)
+		one.Span = p.curTok.Span
+		ass.L = ret
+		ass.R = one
+		ass.Span = ret.GetSpan()
+		ass.Span.End = p.curTok.Span.End
 		p.next()
+		ret = ass
 	default:
 		es := &ExpressionStatement{}
 		es.Expr = ret
@@ -353,11 +733,11 @@ func (p *parser) parseFor() *For {
 	if p.curTok.Kind == '{' {
 		p.expect('{')
 		p.parseStatementList(&ret.Body)
-		p.expect('}')
+		p.expectBlockEnd()
 		return ret
 	}
 
-	ret.Init = p.parseSimpleStatement()
+	ret.Init = p.withCompositeLits(false, p.parseSimpleStatement)
 
 	if p.curTok.Kind == '{' {
 		ret.Cond = ret.Init
@@ -369,21 +749,21 @@ func (p *parser) parseFor() *For {
 		ret.Init = nil
 		p.expect('{')
 		p.parseStatementList(&ret.Body)
-		p.expect('}')
+		p.expectBlockEnd()
 		return ret
 	}
 	p.expect(';')
 
 	if p.curTok.Kind != ';' {
-		ret.Cond = p.parseExpression()
+		ret.Cond = p.withCompositeLits(false, p.parseExpression)
 	}
 	p.expect(';')
 	if p.curTok.Kind != '{' {
-		ret.Step = p.parseSimpleStatement()
+		ret.Step = p.withCompositeLits(false, p.parseSimpleStatement)
 	}
 	p.expect('{')
 	p.parseStatementList(&ret.Body)
-	p.expect('}')
+	p.expectBlockEnd()
 	return ret
 }
 
@@ -391,10 +771,10 @@ func (p *parser) parseIf() *If {
 	ret := &If{}
 	ret.Span = p.curTok.Span
 	p.expect(IF)
-	ret.Cond = p.parseExpression()
+	ret.Cond = p.withCompositeLits(false, p.parseExpression)
 	p.expect('{')
 	p.parseStatementList(&ret.Body)
-	p.expect('}')
+	p.expectBlockEnd()
 	if p.curTok.Kind == ELSE {
 		p.next()
 		switch p.curTok.Kind {
@@ -403,7 +783,7 @@ func (p *parser) parseIf() *If {
 		case '{':
 			p.expect('{')
 			p.parseStatementList(&ret.Els)
-			p.expect('}')
+			p.expectBlockEnd()
 		default:
 			p.syntaxError("If ", p.curTok.Span)
 		}
@@ -411,6 +791,70 @@ func (p *parser) parseIf() *If {
 	return ret
 }
 
+func (p *parser) parseSwitch() *Switch {
+	ret := &Switch{}
+	ret.Span = p.curTok.Span
+	p.expect(SWITCH)
+	if p.curTok.Kind != '{' {
+		ret.Expr = p.withCompositeLits(false, p.parseExpression)
+	}
+	p.expect('{')
+	ret.Cases = p.parseCaseClauses()
+	ret.Span.End = p.curTok.Span.End
+	p.expectBlockEnd()
+	return ret
+}
+
+func (p *parser) parseMatch() *Match {
+	ret := &Match{}
+	ret.Span = p.curTok.Span
+	p.expect(MATCH)
+	ret.Expr = p.withCompositeLits(false, p.parseExpression)
+	p.expect('{')
+	ret.Cases = p.parseCaseClauses()
+	ret.Span.End = p.curTok.Span.End
+	p.expectBlockEnd()
+	return ret
+}
+
+func (p *parser) parseCaseClauses() []*SwitchCase {
+	var ret []*SwitchCase
+	for p.curTok.Kind == CASE || p.curTok.Kind == DEFAULT {
+		c := &SwitchCase{}
+		c.Span = p.curTok.Span
+		if p.curTok.Kind == DEFAULT {
+			c.IsDefault = true
+			p.next()
+		} else {
+			p.next()
+			c.Values = append(c.Values, p.parseCaseValue())
+			for p.curTok.Kind == ',' {
+				p.next()
+				c.Values = append(c.Values, p.parseCaseValue())
+			}
+		}
+		c.Span.End = p.curTok.Span.End
+		p.expect(':')
+		p.parseStatementList(&c.Body)
+		ret = append(ret, c)
+	}
+	return ret
+}
+
+func (p *parser) parseCaseValue() Node {
+	v := p.parseExpression()
+	if p.curTok.Kind != DOTDOT {
+		return v
+	}
+	p.next()
+	r := &CaseRange{}
+	r.Low = v
+	r.High = p.parseExpression()
+	r.Span = v.GetSpan()
+	r.Span.End = r.High.GetSpan().End
+	return r
+}
+
 func (p *parser) parseExpression() Node {
 	return p.parsePrec1()
 }
@@ -515,7 +959,8 @@ func (p *parser) parsePrec5() Node {
 }
 
 func tokToInt64(t *Token) (int64, error) {
-	v, err := strconv.ParseInt(t.Val, 10, 64)
+	// Base 0 accepts the same prefixes and separators as the lexer.
+	v, err := strconv.ParseInt(t.Val, 0, 64)
 	if err != nil {
 		return 0, err
 	}
@@ -527,14 +972,13 @@ func (p *parser) parsePrimaryExpression() Node {
 	var ret Node = nil
 
 	switch p.curTok.Kind {
-	case FUNC, STRUCT, '[':
-		// Resolve is going to need to deal with converting Unop * to ptr.
-		// Resolve also has to deal with the ambiguity of *foo(bar)
-		// If foo is a type, its a cast, else its a call.
-		// Confirmed for type cast, parse the type.
+	case FUNC, STRUCT, UNION, '[':
+		// A type in an expression is converted to or is the type of a
+		// composite literal. Whether foo(bar) or (*foo)(bar) is a call or
+		// a conversion depends on what foo is, the resolver decides.
 		ty := p.parseType(false)
 		ret = ty
-	case '&', '*', '-':
+	case '&', '*', '-', '!':
 		newu := &Unop{}
 		newu.Op = p.curTok.Kind
 		newu.Span = p.curTok.Span
@@ -544,7 +988,14 @@ func (p *parser) parsePrimaryExpression() Node {
 		newu.Span.End = expr.GetSpan().End
 		ret = newu
 	case '{':
-		ret = p.parseInitializer()
+		ret = p.parseInitializer(nil)
+	case NEW:
+		n := &New{}
+		n.Span = p.curTok.Span
+		p.next()
+		n.Type = p.parseType(false)
+		n.Span.End = n.Type.GetSpan().End
+		ret = n
 	case IDENTIFIER:
 		v := &Ident{}
 		v.Val = p.curTok.Val
@@ -553,19 +1004,46 @@ func (p *parser) parsePrimaryExpression() Node {
 		ret = v
 	case CONSTANT:
 		v := &Constant{}
-		c, err := tokToInt64(p.curTok)
+		c, ok := new(big.Int).SetString(p.curTok.Val, 0)
+		if !ok {
+			p.syntaxError(fmt.Sprintf("malformed constant %s", p.curTok.Val), p.curTok.Span)
+		}
+		v.Val = c
+		v.Span = p.curTok.Span
+		p.next()
+		ret = v
+	case CHARCONSTANT:
+		// Character literals are untyped integer constants.
+		v := &Constant{}
+		c, err := charLiteralValue(p.curTok.Val)
 		if err != nil {
 			p.syntaxError(err.Error(), p.curTok.Span)
 		}
-		v.Val = c
+		v.Val = new(big.Int).SetUint64(uint64(c))
+		v.Span = p.curTok.Span
+		p.next()
+		ret = v
+	case FLOATCONSTANT:
+		v := &FloatConstant{}
+		f, _, err := big.ParseFloat(p.curTok.Val, 0, FloatConstantPrec, big.ToNearestEven)
+		if err != nil {
+			p.syntaxError(fmt.Sprintf("malformed float constant %s", p.curTok.Val), p.curTok.Span)
+		}
+		v.Val = f
 		v.Span = p.curTok.Span
 		p.next()
 		ret = v
 	case STRING:
 		ret = p.parseString()
 	case '(':
+		// A parenthesized list of expressions is a tuple.
+		span := p.curTok.Span
 		p.expect('(')
-		ret = p.parseExpression()
+		ret = p.withCompositeLits(true, p.parseExpressionList)
+		if tup, ok := ret.(*Tuple); ok {
+			tup.Span.Start = span.Start
+			tup.Span.End = p.curTok.Span.End
+		}
 		p.expect(')')
 	default:
 		p.syntaxError("error parsing expression", p.curTok.Span)
@@ -580,6 +1058,11 @@ loop:
 			ret = p.parseSelector(ret)
 		case '[':
 			ret = p.parseIndex(ret)
+		case '{':
+			if p.noCompositeLit || !isLiteralType(ret) {
+				break loop
+			}
+			ret = p.parseInitializer(ret)
 		default:
 			break loop
 		}
@@ -595,7 +1078,7 @@ func (p *parser) parseCall(funcLike Node) *Call {
 	var args []Node
 	p.expect('(')
 	for p.curTok.Kind != ')' && p.curTok.Kind != EOF {
-		arg := p.parseExpression()
+		arg := p.withCompositeLits(true, p.parseExpression)
 		args = append(args, arg)
 		if p.curTok.Kind == ',' {
 			p.next()
@@ -612,7 +1095,7 @@ func (p *parser) parseIndex(l Node) *IndexInto {
 	idx.Span = l.GetSpan()
 	idx.Expr = l
 	p.expect('[')
-	idx.Index = p.parseExpression()
+	idx.Index = p.withCompositeLits(true, p.parseExpression)
 	idx.Span.End = p.curTok.Span.End
 	p.expect(']')
 	return idx
@@ -629,16 +1112,50 @@ func (p *parser) parseSelector(l Node) *Selector {
 	return sel
 }
 
-func (p *parser) parseInitializer() *Initializer {
+// Can n be the type of a composite literal.
+func isLiteralType(n Node) bool {
+	switch n := n.(type) {
+	case *Ident, *ArrayOf, *Struct:
+		return true
+	case *Selector:
+		_, ok := n.Expr.(*Ident)
+		return ok
+	}
+	return false
+}
+
+func (p *parser) parseInitializer(t Node) *Initializer {
 	ret := &Initializer{}
+	ret.Type = t
 	ret.Span = p.curTok.Span
+	if t != nil {
+		ret.Span = t.GetSpan()
+	}
 	p.expect('{')
-	p.parseExpression()
-	for p.curTok.Kind == ',' {
-		p.expect(',')
-		p.parseExpression()
+	for p.curTok.Kind != '}' && p.curTok.Kind != EOF {
+		ret.Sub = append(ret.Sub, p.parseInitializerElem())
+		if p.curTok.Kind != ',' {
+			break
+		}
+		p.next()
 	}
 	ret.Span.End = p.curTok.Span.End
 	p.expect('}')
 	return ret
 }
+
+func (p *parser) parseInitializerElem() Node {
+	if p.curTok.Kind != IDENTIFIER || p.nextTok.Kind != ':' {
+		return p.withCompositeLits(true, p.parseExpression)
+	}
+	kv := &KeyValue{}
+	kv.Key = &Ident{}
+	kv.Key.Span = p.curTok.Span
+	kv.Key.Val = p.curTok.Val
+	kv.Span = p.curTok.Span
+	p.expect(IDENTIFIER)
+	p.expect(':')
+	kv.Val = p.withCompositeLits(true, p.parseExpression)
+	kv.Span.End = kv.Val.GetSpan().End
+	return kv
+}
@@ -0,0 +1,114 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func parseString(path, src string) (*File, error) {
+	tokChan, _ := Lex(path, strings.NewReader(src))
+	return Parse(tokChan)
+}
+
+// The kinds of the statements in a body, to check what survived recovery.
+func statementKinds(body []Node) string {
+	var kinds []string
+	for _, n := range body {
+		kinds = append(kinds, strings.TrimPrefix(fmt.Sprintf("%T", n), "*parse."))
+	}
+	return strings.Join(kinds, " ")
+}
+
+const recoverySource = `package main
+
+func badStatement() int {
+	var a int = 1
+	a = (1 +
+	var b int = 2
+	return a + b
+}
+
+func unclosedAfterError() int {
+	if true {
+		return (1
+	}
+
+type T struct {
+	a int
+}
+
+func unclosed() {
+	var c int = 3
+
+const k = 4
+
+var v int = 5 +
+const j = 6
+
+func nestedUnclosed() {
+	for {
+		if true {
+			break
+		}
+
+func good() int {
+	return 0
+}
+
+)
+`
+
+func TestSyntaxErrorRecovery(t *testing.T) {
+	f, err := parseString("rec.g", recoverySource)
+	if err == nil {
+		t.Fatal("expected syntax errors")
+	}
+	expected := []string{
+		"rec.g:6:5: error: error parsing expression",
+		"rec.g:12:18: error: unexpected token ';', expected ')'",
+		"rec.g:22:1: error: unexpected token 'const', expected '}'",
+		"rec.g:25:1: error: error parsing expression",
+		"rec.g:33:1: error: unexpected token 'func', expected '}'",
+		"rec.g:37:1: error: expected var, type, const or func got )",
+	}
+	diags, ok := err.(DiagnosticList)
+	if !ok {
+		t.Fatalf("expected a DiagnosticList, got %T", err)
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("got errors:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	// Functions with syntax errors are kept without their bad statements.
+	bodies := map[string]string{
+		"badStatement":       "VarDecl VarDecl Return",
+		"unclosedAfterError": "If EmptyStatement",
+		"unclosed":           "VarDecl",
+		"nestedUnclosed":     "",
+		"good":               "Return",
+	}
+	if len(f.FuncDecls) != len(bodies) {
+		t.Fatalf("expected %d functions, got %d", len(bodies), len(f.FuncDecls))
+	}
+	for _, fd := range f.FuncDecls {
+		expected, ok := bodies[fd.Name]
+		if !ok {
+			t.Errorf("unexpected function %s", fd.Name)
+			continue
+		}
+		if got := statementKinds(fd.Body); got != expected {
+			t.Errorf("body of %s is %q, expected %q", fd.Name, got, expected)
+		}
+	}
+	if len(f.TypeDecls) != 1 || f.TypeDecls[0].Name != "T" {
+		t.Errorf("expected type T to be kept")
+	}
+	if len(f.ConstDecls) != 2 {
+		t.Errorf("expected 2 constants, got %d", len(f.ConstDecls))
+	}
+}
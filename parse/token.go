@@ -41,6 +41,18 @@ const (
 	OR
 	LSHIFT
 	RSHIFT
+	SWITCH
+	CASE
+	DEFAULT
+	DOTDOT
+	ENUM
+	TUNION
+	MATCH
+	UNION
+	DEFER
+	FLOATCONSTANT
+	CHARCONSTANT
+	NEW
 )
 
 func (k TokenKind) String() string {
@@ -49,39 +61,52 @@ func (k TokenKind) String() string {
 	}
 
 	var lut = map[TokenKind]string{
-		FOR:        "for",
-		PACKAGE:    "package",
-		IMPORT:     "import",
-		FUNC:       "func",
-		BREAK:      "break",
-		CONTINUE:   "continue",
-		RETURN:     "return",
-		STRUCT:     "struct",
-		CONSTANT:   "constant",
-		STRING:     "string",
-		IDENTIFIER: "identifier",
-		VAR:        "var",
-		CONST:      "const",
-		TYPE:       "type",
-		IF:         "if",
-		ELSE:       "else",
-		NEQ:        "!=",
-		EQ:         "==",
-		LTEQ:       "<=",
-		GTEQ:       ">=",
-		INC:        "++",
-		DEC:        "--",
-		ADDASSIGN:  "+=",
-		SUBASSIGN:  "-=",
-		MULASSIGN:  "*=",
-		XORASSIGN:  "^=",
-		ORASSIGN:   "^=",
-		AND:        "&&",
-		ANDNOT:     "&^",
-		OR:         "||",
-		LSHIFT:     "<<",
-		RSHIFT:     ">>",
-		ELLIPSIS:   "...",
+		FOR:           "for",
+		PACKAGE:       "package",
+		IMPORT:        "import",
+		FUNC:          "func",
+		BREAK:         "break",
+		CONTINUE:      "continue",
+		RETURN:        "return",
+		STRUCT:        "struct",
+		CONSTANT:      "constant",
+		FLOATCONSTANT: "float constant",
+		CHARCONSTANT:  "char constant",
+		STRING:        "string",
+		IDENTIFIER:    "identifier",
+		VAR:           "var",
+		CONST:         "const",
+		TYPE:          "type",
+		IF:            "if",
+		ELSE:          "else",
+		NEQ:           "!=",
+		EQ:            "==",
+		LTEQ:          "<=",
+		GTEQ:          ">=",
+		INC:           "++",
+		DEC:           "--",
+		ADDASSIGN:     "+=",
+		SUBASSIGN:     "-=",
+		MULASSIGN:     "*=",
+		XORASSIGN:     "^=",
+		ORASSIGN:      "|=",
+		ANDASSIGN:     "&=",
+		AND:           "&&",
+		ANDNOT:        "&^",
+		OR:            "||",
+		LSHIFT:        "<<",
+		RSHIFT:        ">>",
+		ELLIPSIS:      "...",
+		SWITCH:        "switch",
+		CASE:          "case",
+		DEFAULT:       "default",
+		DOTDOT:        "..",
+		ENUM:          "enum",
+		TUNION:        "tunion",
+		MATCH:         "match",
+		UNION:         "union",
+		DEFER:         "defer",
+		NEW:           "new",
 	}
 	s, ok := lut[k]
 	if ok {
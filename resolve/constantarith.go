@@ -0,0 +1,238 @@
+package resolve
+
+import (
+	"fmt"
+	"github.com/andrewchambers/g/parse"
+	"math"
+	"math/big"
+)
+
+// Constant values are represented as *big.Int for integer constants,
+// *big.Float for float constants, bool for boolean constants and nil
+// for nil. Integer constants are folded with arbitrary precision and
+// floats with parse.FloatConstantPrec bits, they only need to fit a type
+// once they are given one. Values are never modified once created.
+
+// Shifting by more than this is an error rather than an attempt to
+// build an enormous constant.
+const maxConstantShift = 4096
+
+func foldConstantUnop(op parse.TokenKind, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case *big.Int:
+		switch op {
+		case '-':
+			return new(big.Int).Neg(v), nil
+		default:
+			return nil, fmt.Errorf("unhandled unary operator %s", op)
+		}
+	case *big.Float:
+		switch op {
+		case '-':
+			return newFloatConstant().Neg(v), nil
+		default:
+			return nil, fmt.Errorf("unhandled unary operator %s", op)
+		}
+	case bool:
+		switch op {
+		case '!':
+			return !v, nil
+		default:
+			return nil, fmt.Errorf("unhandled unary operator %s", op)
+		}
+	default:
+		return nil, fmt.Errorf("internal error (unhandled constant type)")
+	}
+}
+
+func foldConstantBinop(op parse.TokenKind, l, r interface{}) (interface{}, error) {
+	// Mixing integer and float constants gives a float.
+	if li, ok := l.(*big.Int); ok {
+		if _, ok := r.(*big.Float); ok {
+			l = intToFloatConstant(li)
+		}
+	}
+	if ri, ok := r.(*big.Int); ok {
+		if _, ok := l.(*big.Float); ok {
+			r = intToFloatConstant(ri)
+		}
+	}
+
+	switch l := l.(type) {
+	case *big.Float:
+		r, ok := r.(*big.Float)
+		if !ok {
+			return nil, fmt.Errorf("mismatched types for %s operator", op)
+		}
+		ret := newFloatConstant()
+		switch op {
+		case '+':
+			return ret.Add(l, r), nil
+		case '-':
+			return ret.Sub(l, r), nil
+		case '*':
+			return ret.Mul(l, r), nil
+		case '/':
+			if r.Sign() == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return ret.Quo(l, r), nil
+		case parse.EQ:
+			return l.Cmp(r) == 0, nil
+		case parse.NEQ:
+			return l.Cmp(r) != 0, nil
+		case '<':
+			return l.Cmp(r) < 0, nil
+		case parse.LTEQ:
+			return l.Cmp(r) <= 0, nil
+		case '>':
+			return l.Cmp(r) > 0, nil
+		case parse.GTEQ:
+			return l.Cmp(r) >= 0, nil
+		default:
+			return nil, fmt.Errorf("operator %s not defined on float constants", op)
+		}
+	case *big.Int:
+		r, ok := r.(*big.Int)
+		if !ok {
+			return nil, fmt.Errorf("mismatched types for %s operator", op)
+		}
+		ret := new(big.Int)
+		switch op {
+		case '+':
+			return ret.Add(l, r), nil
+		case '&':
+			return ret.And(l, r), nil
+		case '^':
+			return ret.Xor(l, r), nil
+		case '|':
+			return ret.Or(l, r), nil
+		case parse.LSHIFT, parse.RSHIFT:
+			if r.Sign() < 0 {
+				return nil, fmt.Errorf("negative shift count")
+			}
+			if r.Cmp(big.NewInt(maxConstantShift)) > 0 {
+				return nil, fmt.Errorf("shift count %s too large", r)
+			}
+			if op == parse.LSHIFT {
+				return ret.Lsh(l, uint(r.Uint64())), nil
+			}
+			return ret.Rsh(l, uint(r.Uint64())), nil
+		case '-':
+			return ret.Sub(l, r), nil
+		case '*':
+			return ret.Mul(l, r), nil
+		case '%':
+			if r.Sign() == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			// Rem and Quo truncate towards zero like the generated code.
+			return ret.Rem(l, r), nil
+		case '/':
+			if r.Sign() == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return ret.Quo(l, r), nil
+		case parse.ANDNOT:
+			return ret.AndNot(l, r), nil
+		case parse.EQ:
+			return l.Cmp(r) == 0, nil
+		case parse.NEQ:
+			return l.Cmp(r) != 0, nil
+		case '<':
+			return l.Cmp(r) < 0, nil
+		case parse.LTEQ:
+			return l.Cmp(r) <= 0, nil
+		case '>':
+			return l.Cmp(r) > 0, nil
+		case parse.GTEQ:
+			return l.Cmp(r) >= 0, nil
+		default:
+			return nil, fmt.Errorf("unhandled binary operator %s", op)
+		}
+	case nil:
+		// Typed nil pointers only compare with nil.
+		if r != nil {
+			return nil, fmt.Errorf("mismatched types for %s operator", op)
+		}
+		switch op {
+		case parse.EQ:
+			return true, nil
+		case parse.NEQ:
+			return false, nil
+		default:
+			return nil, fmt.Errorf("unhandled binary operator %s", op)
+		}
+	case bool:
+		r, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("mismatched types for %s operator", op)
+		}
+		switch op {
+		case parse.EQ:
+			return l == r, nil
+		case parse.NEQ:
+			return l != r, nil
+		case parse.AND, '&':
+			return l && r, nil
+		case parse.OR, '|':
+			return l || r, nil
+		case '^':
+			return l != r, nil
+		default:
+			return nil, fmt.Errorf("unhandled binary operator %s", op)
+		}
+	default:
+		return nil, fmt.Errorf("internal error (unhandled constant type)")
+	}
+}
+
+func newFloatConstant() *big.Float {
+	return new(big.Float).SetPrec(parse.FloatConstantPrec)
+}
+
+func intToFloatConstant(v *big.Int) *big.Float {
+	return newFloatConstant().SetInt(v)
+}
+
+// Returns the integer value of a float constant, ok is false if the
+// constant has a fractional part.
+func floatToIntConstant(v *big.Float) (*big.Int, bool) {
+	if !v.IsInt() {
+		return nil, false
+	}
+	ret, _ := v.Int(nil)
+	return ret, true
+}
+
+// Round a float constant to the precision of t, ok is false if the
+// value overflows t.
+func roundFloatConstant(v *big.Float, t *GFloat) (*big.Float, bool) {
+	var f float64
+	if t.Bits == 32 {
+		f32, _ := v.Float32()
+		if math.IsInf(float64(f32), 0) {
+			return nil, false
+		}
+		f = float64(f32)
+	} else {
+		f, _ = v.Float64()
+		if math.IsInf(f, 0) {
+			return nil, false
+		}
+	}
+	return newFloatConstant().SetFloat64(f), true
+}
+
+// Check an integer constant can be represented by an int type.
+func constantFitsInt(v *big.Int, t *GInt) bool {
+	var lo, hi big.Int
+	if t.Signed {
+		lo.Lsh(big.NewInt(1), t.Bits-1)
+		lo.Neg(&lo)
+		hi.Lsh(big.NewInt(1), t.Bits-1)
+	} else {
+		hi.Lsh(big.NewInt(1), t.Bits)
+	}
+	return v.Cmp(&lo) >= 0 && v.Cmp(&hi) < 0
+}
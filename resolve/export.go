@@ -0,0 +1,500 @@
+package resolve
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/andrewchambers/g/parse"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Export data describes what importers of a package can see without its
+// source: the exported symbols, with every named type they mention declared
+// by the package. It is line oriented text, each line is a keyword followed
+// by space separated tokens.
+//
+//	package <name> <path>
+//	names <n> <name>...          named types of the package, numbered from 0
+//	named <k> <type>             the underlying type of named type k
+//	type <name> <type>
+//	const <name> <type> <value>
+//	var <name> <type>
+//	func <name> <type>
+//
+// Types are written in prefix form, so they can be read back token by token.
+//
+//	i<bits> u<bits> f<bits> void char untyped untypedfloat nil
+//	int|uint|uintptr <type>      builtin of the width of the integer type
+//	* <type>                     pointer
+//	[ <dim> <type>               array
+//	struct <n> (<name> <type>)...
+//	union <n> (<name> <type>)...
+//	tunion <n> (<name> <type>)...
+//	tuple <n> <type>...
+//	func <n> <type>... <ret>
+//	enum <type> <n> <member>...
+//	@<k>                         named type k of this package
+//	ext <path> <name>            named type of an imported package
+//
+// Constant values are "int <decimal>", "float <hex mantissa>p<exp>",
+// "bool <true|false>" or "nil".
+
+// Write the export data of a package resolved from source.
+func WriteExportData(w io.Writer, pkg *Package) error {
+	ew := &exportWriter{
+		out:   bufio.NewWriter(w),
+		pkg:   pkg,
+		index: make(map[*GNamedType]int),
+	}
+	names := make([]string, 0, len(pkg.Exports))
+	for name := range pkg.Exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ew.collectNamed(exportedType(pkg.Exports[name]))
+	}
+
+	fmt.Fprintf(ew.out, "package %s %s\n", pkg.Name, pkg.Path)
+	fmt.Fprintf(ew.out, "names %d", len(ew.named))
+	for _, t := range ew.named {
+		fmt.Fprintf(ew.out, " %s", t.Name)
+	}
+	fmt.Fprintf(ew.out, "\n")
+	for idx, t := range ew.named {
+		fmt.Fprintf(ew.out, "named %d %s\n", idx, ew.typeString(t.Type))
+	}
+	for _, name := range names {
+		switch sym := pkg.Exports[name].(type) {
+		case *TypeSymbol:
+			fmt.Fprintf(ew.out, "type %s %s\n", name, ew.typeString(sym.Type))
+		case *ConstSymbol:
+			fmt.Fprintf(ew.out, "const %s %s %s\n", name, ew.typeString(sym.Type), constString(sym.Val))
+		case *GlobalSymbol:
+			fmt.Fprintf(ew.out, "var %s %s\n", name, ew.typeString(sym.Type))
+		case *FuncSymbol:
+			fmt.Fprintf(ew.out, "func %s %s\n", name, ew.typeString(sym.Type))
+		default:
+			panic("internal error")
+		}
+	}
+	return ew.out.Flush()
+}
+
+func exportedType(sym Symbol) GType {
+	switch sym := sym.(type) {
+	case *TypeSymbol:
+		return sym.Type
+	case *ConstSymbol:
+		return sym.Type
+	case *GlobalSymbol:
+		return sym.Type
+	case *FuncSymbol:
+		return sym.Type
+	}
+	panic("internal error")
+}
+
+type exportWriter struct {
+	out *bufio.Writer
+	pkg *Package
+	// Named types of the package reachable from its exports, in the order
+	// they are numbered.
+	named []*GNamedType
+	index map[*GNamedType]int
+}
+
+func (ew *exportWriter) isLocal(t *GNamedType) bool {
+	return !isBuiltinNamed(t) && t.Pkg == ew.pkg.Path
+}
+
+func isBuiltinNamed(t *GNamedType) bool {
+	if t == builtinCharGType {
+		return true
+	}
+	it, ok := t.Type.(*GInt)
+	return ok && getBuiltinSizedType(t.Name, it.Bits) == t
+}
+
+func (ew *exportWriter) collectNamed(t GType) {
+	switch t := t.(type) {
+	case *GNamedType:
+		if !ew.isLocal(t) {
+			return
+		}
+		if _, ok := ew.index[t]; ok {
+			return
+		}
+		ew.index[t] = len(ew.named)
+		ew.named = append(ew.named, t)
+		ew.collectNamed(t.Type)
+	case *GPointer:
+		ew.collectNamed(t.PointsTo)
+	case *GArray:
+		ew.collectNamed(t.SubType)
+	case *GStruct:
+		ew.collectAll(t.Types)
+	case *GUnion:
+		ew.collectAll(t.Types)
+	case *GTaggedUnion:
+		ew.collectAll(t.Types)
+	case *GTuple:
+		ew.collectAll(t.Types)
+	case *GFunc:
+		ew.collectAll(t.ArgTypes)
+		ew.collectNamed(t.RetType)
+	}
+}
+
+func (ew *exportWriter) collectAll(types []GType) {
+	for _, t := range types {
+		ew.collectNamed(t)
+	}
+}
+
+func (ew *exportWriter) typeString(t GType) string {
+	switch t := t.(type) {
+	case *GNamedType:
+		if t == builtinCharGType {
+			return "char"
+		}
+		if isBuiltinNamed(t) {
+			// The width of int, uint and uintptr depends on the target.
+			return t.Name + " " + ew.typeString(t.Type)
+		}
+		if ew.isLocal(t) {
+			return fmt.Sprintf("@%d", ew.index[t])
+		}
+		return fmt.Sprintf("ext %s %s", t.Pkg, t.Name)
+	case *GInt:
+		if t.Signed {
+			return fmt.Sprintf("i%d", t.Bits)
+		}
+		return fmt.Sprintf("u%d", t.Bits)
+	case *GFloat:
+		return fmt.Sprintf("f%d", t.Bits)
+	case *GVoid:
+		return "void"
+	case *GConstant:
+		if t.Float {
+			return "untypedfloat"
+		}
+		return "untyped"
+	case *GNil:
+		return "nil"
+	case *GPointer:
+		return "* " + ew.typeString(t.PointsTo)
+	case *GArray:
+		return fmt.Sprintf("[ %d %s", t.Dim, ew.typeString(t.SubType))
+	case *GStruct:
+		return "struct " + ew.fieldsString(t.Names, t.Types)
+	case *GUnion:
+		return "union " + ew.fieldsString(t.Names, t.Types)
+	case *GTaggedUnion:
+		return "tunion " + ew.fieldsString(t.Names, t.Types)
+	case *GTuple:
+		return fmt.Sprintf("tuple %d%s", len(t.Types), ew.typesString(t.Types))
+	case *GFunc:
+		return fmt.Sprintf("func %d%s %s", len(t.ArgTypes), ew.typesString(t.ArgTypes), ew.typeString(t.RetType))
+	case *GEnum:
+		return fmt.Sprintf("enum %s %d %s", ew.typeString(t.Type), len(t.Members), strings.Join(t.Members, " "))
+	}
+	panic("internal error")
+}
+
+func (ew *exportWriter) typesString(types []GType) string {
+	ret := ""
+	for _, t := range types {
+		ret += " " + ew.typeString(t)
+	}
+	return ret
+}
+
+func (ew *exportWriter) fieldsString(names []string, types []GType) string {
+	ret := strconv.Itoa(len(names))
+	for idx := range names {
+		ret += " " + names[idx] + " " + ew.typeString(types[idx])
+	}
+	return ret
+}
+
+func constString(v interface{}) string {
+	switch v := v.(type) {
+	case *big.Int:
+		return "int " + v.String()
+	case *big.Float:
+		return "float " + v.Text('p', 0)
+	case bool:
+		return "bool " + strconv.FormatBool(v)
+	case nil:
+		return "nil"
+	}
+	panic("internal error")
+}
+
+// Read export data written by WriteExportData. Packages it refers to are
+// loaded with imp, so named types are shared with other importers of them.
+func ReadExportData(rd io.Reader, imp Importer) (pkg *Package, err error) {
+	er := &exportReader{imp: imp}
+	defer func() {
+		if e := recover(); e != nil {
+			bad, ok := e.(*badExportData)
+			if !ok {
+				panic(e)
+			}
+			pkg, err = nil, bad
+		}
+	}()
+	pkg = &Package{
+		Exports: make(map[string]Symbol),
+		Types:   make(map[string]*GNamedType),
+	}
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		er.toks = strings.Fields(scanner.Text())
+		er.line++
+		if len(er.toks) == 0 {
+			continue
+		}
+		switch kw := er.next(); kw {
+		case "package":
+			pkg.Name = er.next()
+			if len(er.toks) != 0 {
+				pkg.Path = er.next()
+			}
+		case "names":
+			n := er.count()
+			for idx := 0; idx < n; idx++ {
+				t := &GNamedType{Name: er.next(), Pkg: pkg.Path}
+				er.named = append(er.named, t)
+				pkg.Types[t.Name] = t
+			}
+		case "named":
+			idx := er.count()
+			if idx >= len(er.named) {
+				er.errorf("bad named type %d", idx)
+			}
+			er.named[idx].Type = er.readType()
+		case "type":
+			name := er.next()
+			pkg.Exports[name] = &TypeSymbol{Name: name, Type: er.readType()}
+		case "const":
+			name := er.next()
+			t := er.readType()
+			pkg.Exports[name] = &ConstSymbol{Name: name, Type: t, Val: er.readConst()}
+		case "var":
+			name := er.next()
+			pkg.Exports[name] = &GlobalSymbol{Name: name, Type: er.readType(), Pkg: pkg.Path}
+		case "func":
+			name := er.next()
+			ft, ok := er.readType().(*GFunc)
+			if !ok {
+				er.errorf("%s is not a function", name)
+			}
+			pkg.Exports[name] = &FuncSymbol{Name: name, Type: ft, Pkg: pkg.Path}
+		default:
+			er.errorf("unknown entry %s", kw)
+		}
+		if len(er.toks) != 0 {
+			er.errorf("unexpected %s", er.toks[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, t := range er.named {
+		if t.Type == nil {
+			er.errorf("named type %s has no definition", t.Name)
+		}
+	}
+	return pkg, nil
+}
+
+type badExportData struct {
+	line int
+	msg  string
+}
+
+func (e *badExportData) Error() string {
+	return fmt.Sprintf("malformed export data, line %d: %s", e.line, e.msg)
+}
+
+type exportReader struct {
+	imp   Importer
+	named []*GNamedType
+	toks  []string
+	line  int
+}
+
+func (er *exportReader) errorf(format string, args ...interface{}) {
+	panic(&badExportData{er.line, fmt.Sprintf(format, args...)})
+}
+
+func (er *exportReader) next() string {
+	if len(er.toks) == 0 {
+		er.errorf("unexpected end of line")
+	}
+	tok := er.toks[0]
+	er.toks = er.toks[1:]
+	return tok
+}
+
+func (er *exportReader) count() int {
+	tok := er.next()
+	n, err := strconv.Atoi(tok)
+	if err != nil || n < 0 {
+		er.errorf("bad count %s", tok)
+	}
+	return n
+}
+
+func (er *exportReader) bits(tok string) uint {
+	n, err := strconv.ParseUint(tok[1:], 10, 8)
+	if err != nil {
+		er.errorf("bad type %s", tok)
+	}
+	return uint(n)
+}
+
+func (er *exportReader) readType() GType {
+	tok := er.next()
+	switch tok {
+	case "void":
+		return builtinVoidGType
+	case "char":
+		return builtinCharGType
+	case "int", "uint", "uintptr":
+		it, ok := er.readType().(*GInt)
+		if !ok {
+			er.errorf("%s of a non integer type", tok)
+		}
+		t := getBuiltinSizedType(tok, it.Bits)
+		if t == nil {
+			er.errorf("bad %s width %d", tok, it.Bits)
+		}
+		return t
+	case "untyped":
+		return &GConstant{}
+	case "untypedfloat":
+		return &GConstant{Float: true}
+	case "nil":
+		return &GNil{}
+	case "*":
+		return &GPointer{PointsTo: er.readType()}
+	case "[":
+		dim, err := strconv.ParseUint(er.next(), 10, 64)
+		if err != nil {
+			er.errorf("bad array dimension")
+		}
+		return &GArray{Dim: uint(dim), SubType: er.readType()}
+	case "struct":
+		names, types := er.readFields()
+		return &GStruct{Names: names, Types: types}
+	case "union":
+		names, types := er.readFields()
+		return &GUnion{Names: names, Types: types}
+	case "tunion":
+		names, types := er.readFields()
+		return &GTaggedUnion{Names: names, Types: types}
+	case "tuple":
+		return &GTuple{Types: er.readTypes(er.count())}
+	case "func":
+		args := er.readTypes(er.count())
+		return &GFunc{ArgTypes: args, RetType: er.readType()}
+	case "enum":
+		it, ok := er.readType().(*GInt)
+		if !ok {
+			er.errorf("enum of a non integer type")
+		}
+		ret := &GEnum{Type: it}
+		for n := er.count(); n > 0; n-- {
+			ret.Members = append(ret.Members, er.next())
+		}
+		return ret
+	case "ext":
+		path := er.next()
+		name := er.next()
+		pkg, err := er.imp.Import(path)
+		if err != nil {
+			er.errorf("could not import %q: %s", path, err)
+		}
+		t, ok := pkg.Types[name]
+		if !ok {
+			er.errorf("package %s has no type %s", path, name)
+		}
+		return t
+	}
+	switch tok[0] {
+	case '@':
+		idx, err := strconv.Atoi(tok[1:])
+		if err != nil || idx < 0 || idx >= len(er.named) {
+			er.errorf("bad named type %s", tok)
+		}
+		return er.named[idx]
+	case 'i', 'u':
+		switch n := er.bits(tok); n {
+		case 1, 8, 16, 32, 64:
+			return &GInt{Bits: n, Signed: tok[0] == 'i'}
+		}
+	case 'f':
+		switch n := er.bits(tok); n {
+		case 32, 64:
+			return &GFloat{Bits: n}
+		}
+	}
+	er.errorf("bad type %s", tok)
+	return nil
+}
+
+func (er *exportReader) readTypes(n int) []GType {
+	var ret []GType
+	for ; n > 0; n-- {
+		ret = append(ret, er.readType())
+	}
+	return ret
+}
+
+func (er *exportReader) readFields() ([]string, []GType) {
+	var names []string
+	var types []GType
+	for n := er.count(); n > 0; n-- {
+		names = append(names, er.next())
+		types = append(types, er.readType())
+	}
+	return names, types
+}
+
+func (er *exportReader) readConst() interface{} {
+	switch kind := er.next(); kind {
+	case "int":
+		tok := er.next()
+		v, ok := new(big.Int).SetString(tok, 10)
+		if !ok {
+			er.errorf("bad int constant %s", tok)
+		}
+		return v
+	case "float":
+		tok := er.next()
+		v, _, err := new(big.Float).SetPrec(parse.FloatConstantPrec).Parse(tok, 0)
+		if err != nil {
+			er.errorf("bad float constant %s", tok)
+		}
+		return v
+	case "bool":
+		tok := er.next()
+		v, err := strconv.ParseBool(tok)
+		if err != nil {
+			er.errorf("bad bool constant %s", tok)
+		}
+		return v
+	case "nil":
+		return nil
+	default:
+		er.errorf("bad constant %s", kind)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package resolve
+
+import (
+	"github.com/andrewchambers/g/target"
+)
+
+// Memory layout of types. Layout follows the C ABI of the target machine,
+// scalars are aligned to their own size and aggregates are padded the same
+// way a C compiler would pad them.
+
+// Reports whether t has a size, void and function types do not.
+func hasLayout(t GType) bool {
+	switch underlying(t).(type) {
+	case *GVoid, *GFunc:
+		return false
+	}
+	return true
+}
+
+func alignUp(v, align uint64) uint64 {
+	if align == 0 {
+		return v
+	}
+	return (v + align - 1) / align * align
+}
+
+// Returns the size in bytes of a value of type t.
+func SizeOf(m target.TargetMachine, t GType) uint64 {
+	switch t := underlying(t).(type) {
+	case *GInt:
+		if t.Bits == 1 {
+			return 1
+		}
+		return uint64(t.Bits / 8)
+	case *GFloat:
+		return uint64(t.Bits / 8)
+	case *GEnum:
+		return SizeOf(m, t.Type)
+	case *GPointer:
+		return uint64(m.PointerBitWidth() / 8)
+	case *GArray:
+		return uint64(t.Dim) * SizeOf(m, t.SubType)
+	case *GStruct:
+		size := uint64(0)
+		for _, sub := range t.Types {
+			size = alignUp(size, AlignOf(m, sub)) + SizeOf(m, sub)
+		}
+		return alignUp(size, AlignOf(m, t))
+	case *GTuple:
+		return SizeOf(m, &GStruct{Types: t.Types})
+	case *GUnion:
+		size := uint64(0)
+		for _, sub := range t.Types {
+			if s := SizeOf(m, sub); s > size {
+				size = s
+			}
+		}
+		return alignUp(size, AlignOf(m, t))
+	case *GTaggedUnion:
+		offset, size, _ := TaggedUnionPayload(m, t)
+		return alignUp(offset+size, AlignOf(m, t))
+	case *GVoid:
+		return 0
+	}
+	panic("internal error")
+}
+
+// Returns the required alignment in bytes of a value of type t.
+func AlignOf(m target.TargetMachine, t GType) uint64 {
+	switch t := underlying(t).(type) {
+	case *GInt, *GFloat, *GEnum, *GPointer:
+		return SizeOf(m, t)
+	case *GArray:
+		return AlignOf(m, t.SubType)
+	case *GStruct:
+		align := uint64(1)
+		for _, sub := range t.Types {
+			if a := AlignOf(m, sub); a > align {
+				align = a
+			}
+		}
+		return align
+	case *GTuple:
+		return AlignOf(m, &GStruct{Types: t.Types})
+	case *GUnion:
+		align := uint64(1)
+		for _, sub := range t.Types {
+			if a := AlignOf(m, sub); a > align {
+				align = a
+			}
+		}
+		return align
+	case *GTaggedUnion:
+		_, _, align := TaggedUnionPayload(m, t)
+		if a := AlignOf(m, t.TagType()); a > align {
+			align = a
+		}
+		return align
+	case *GVoid:
+		return 1
+	}
+	panic("internal error")
+}
+
+// Returns the offset in bytes of field idx of a struct.
+func FieldOffset(m target.TargetMachine, s *GStruct, idx int) uint64 {
+	offset := uint64(0)
+	for i, sub := range s.Types {
+		offset = alignUp(offset, AlignOf(m, sub))
+		if i == idx {
+			break
+		}
+		offset += SizeOf(m, sub)
+	}
+	return offset
+}
+
+// Returns the offset, size and alignment of the payload of a tagged union.
+// The payload is large enough for the largest variant and aligned for the
+// most aligned variant.
+func TaggedUnionPayload(m target.TargetMachine, u *GTaggedUnion) (uint64, uint64, uint64) {
+	size := uint64(0)
+	align := uint64(1)
+	for _, sub := range u.Types {
+		if s := SizeOf(m, sub); s > size {
+			size = s
+		}
+		if a := AlignOf(m, sub); a > align {
+			align = a
+		}
+	}
+	offset := alignUp(SizeOf(m, u.TagType()), align)
+	return offset, alignUp(size, align), align
+}
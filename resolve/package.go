@@ -0,0 +1,139 @@
+package resolve
+
+import (
+	"errors"
+	"github.com/andrewchambers/g/parse"
+	"path"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Package is a resolved package as seen by the packages importing it.
+type Package struct {
+	// The name from the package clause, importers refer to the package by it.
+	Name string
+	// The import path, empty for package main.
+	Path string
+	// Exported symbols by name, exported names start with an upper case
+	// letter like Go.
+	Exports map[string]Symbol
+	// Every named type declared by the package, export data of importers
+	// may refer to unexported ones reached through exported symbols.
+	Types map[string]*GNamedType
+}
+
+// An Importer finds, parses and resolves the package with an import path.
+// If the package has problems the error is a parse.DiagnosticList.
+type Importer interface {
+	Import(path string) (*Package, error)
+}
+
+func isExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+// Returns the resolved package, valid once ResolvePackage succeeds.
+func (r *Resolver) Package() *Package {
+	return r.pkg
+}
+
+// Imports bind the name of each imported package at package level, the
+// same package may be imported by several files.
+func (r *Resolver) resolveImports(files []*parse.File) {
+	failed := make(map[string]bool)
+	for _, f := range files {
+		for _, imp := range f.Imports {
+			if failed[imp.Val] {
+				continue
+			}
+			pkg, err := r.importPackage(imp)
+			if err != nil {
+				// The problems of a broken package are reported once, where
+				// they are, any other failure is reported at the import.
+				if diags, ok := err.(parse.DiagnosticList); ok {
+					r.diags = append(r.diags, diags...)
+				} else {
+					r.errorf(imp.Span, "could not import %q: %s", imp.Val, err)
+				}
+				failed[imp.Val] = true
+				// Bind the name a package is likely to have, so its uses
+				// are not reported again as undefined.
+				name := path.Base(imp.Val)
+				if _, ok := r.ps.symkv[name]; !ok {
+					r.ps.symkv[name] = &PackageSymbol{}
+				}
+				continue
+			}
+			if sym, ok := r.ps.symkv[pkg.Name].(*PackageSymbol); ok && sym.Pkg == pkg {
+				continue
+			}
+			r.declare(r.ps, pkg.Name, &PackageSymbol{Pkg: pkg}, imp.Span)
+		}
+	}
+}
+
+func (r *Resolver) importPackage(imp *parse.String) (*Package, error) {
+	if r.importer == nil {
+		return nil, errors.New("imports are not supported")
+	}
+	if imp.Val == "" {
+		return nil, errors.New("empty import path")
+	}
+	if imp.Val == r.pkg.Path {
+		return nil, errors.New("a package cannot import itself")
+	}
+	return r.importer.Import(imp.Val)
+}
+
+func (r *Resolver) collectExports() {
+	for _, t := range r.types {
+		r.pkg.Types[t.Name] = t
+	}
+	for name, sym := range r.ps.symkv {
+		sym = unwrapLazy(sym)
+		if sym == nil || !isExported(name) {
+			continue
+		}
+		if _, ok := sym.(*PackageSymbol); ok {
+			continue
+		}
+		r.pkg.Exports[name] = sym
+	}
+}
+
+// Looks up pkg.Name in the exports of an imported package. isQualified is
+// false if s does not select from an imported package.
+func lookupQualified(sc scope, s *parse.Selector) (sym Symbol, isQualified bool, diag *parse.Diagnostic) {
+	ident, ok := s.Expr.(*parse.Ident)
+	if !ok {
+		return nil, false, nil
+	}
+	found, err := sc.lookupSym(ident.Val)
+	if err != nil {
+		return nil, false, nil
+	}
+	ps, ok := unwrapLazy(found).(*PackageSymbol)
+	if !ok {
+		return nil, false, nil
+	}
+	if ps.Pkg == nil {
+		// The import failed and has been reported.
+		return nil, true, nil
+	}
+	if !isExported(s.Name) {
+		return nil, true, parse.Errorf(s.Span, "cannot refer to unexported name %s", qualifiedName(s))
+	}
+	sym, ok = ps.Pkg.Exports[s.Name]
+	if !ok {
+		return nil, true, parse.Errorf(s.Span, "undefined symbol %s", qualifiedName(s))
+	}
+	return sym, true, nil
+}
+
+func qualifiedName(s *parse.Selector) string {
+	if ident, ok := s.Expr.(*parse.Ident); ok {
+		return ident.Val + "." + s.Name
+	}
+	return s.Name
+}
@@ -1,90 +1,167 @@
 package resolve
 
 import (
-    "fmt"
-    "github.com/andrewchambers/g/parse"
+	"github.com/andrewchambers/g/parse"
 )
 
-
-
 // convert a list of unordered type decls into GNamedTypes. Self referencing types
 // are allowed indirectly through pointers.
 // Will detect:
 //   redefinition of a type.
-//   use of a non type symbol in a type position. 
+//   use of a non type symbol in a type position.
+// Names not declared in decls are looked up in the outer scope.
+// All problems found are returned, types with errors are left with a nil Type.
 
-func getTopLevelNamedTypes(decls []*parse.TypeDecl) ([]*GNamedType,error) {
-    
-    ret := make([]*GNamedType,0,len(decls))
-    tyLookup := make(map[string] *GNamedType)
-    tdLookup := make(map[string] *parse.TypeDecl)
-    
-    // For each type decl create a GNamedType.
-    
-    for _,td := range decls {
-        _,ok := tyLookup[td.Name]
-        if ok {
-            return ret,fmt.Errorf("redefinition of type %s at %s",td.Name,td.GetSpan().Start)
-        }
-        t := &GNamedType{}
-        t.Name = td.Name
-        ret = append(ret,t)
-        tyLookup[td.Name] = t
-        tdLookup[td.Name] = td
-    }
-    
-    lookup := func (i *parse.Ident) (*GNamedType,error) {
-        name := i.Val
-        ty,ok := tyLookup[name]
-        if !ok {
-            return nil,fmt.Errorf("undefined type %s at %s:%s",name,i.GetSpan().Path,i.GetSpan().Start)
-        }
-        return ty,nil
-    }
-    
-    // For each Type decl, recursively create the types.
-    
-    for _,td := range decls {
-        t, err := astNodeToGType(lookup, td.Type)
-        tyLookup[td.Name].Type = t
-        if err != nil {
-            return ret, err
-        }
-    }
+func getTopLevelNamedTypes(pkg string, decls []*parse.TypeDecl, outer scope) ([]*GNamedType, parse.DiagnosticList) {
 
-    
-    // For each GType ensure it does not contain itself in a non reference form.
-    
-    for _,ty := range ret {
-        if containsInvalidTypeRecursion(ty,ty.Type) {
-            td := tdLookup[ty.Name]
-            return ret,fmt.Errorf("self recursive type %s:%s at ",td.GetSpan().Path,td.GetSpan().Start)
-        }
-    }
-    
-    
-    return ret, nil
-}
+	var diags parse.DiagnosticList
+	ret := make([]*GNamedType, 0, len(decls))
+	tyLookup := make(map[string]*GNamedType)
+	tdLookup := make(map[string]*parse.TypeDecl)
+
+	// For each type decl create a GNamedType.
+
+	for _, td := range decls {
+		_, ok := tyLookup[td.Name]
+		if ok {
+			diags = append(diags, parse.Errorf(td.GetSpan(), "redefinition of type %s", td.Name))
+			continue
+		}
+		t := &GNamedType{}
+		t.Name = td.Name
+		t.Pkg = pkg
+		ret = append(ret, t)
+		tyLookup[td.Name] = t
+		tdLookup[td.Name] = td
+	}
+
+	lookup := func(n parse.Node) (GType, *parse.Diagnostic) {
+		if i, ok := n.(*parse.Ident); ok {
+			if ty, ok := tyLookup[i.Val]; ok {
+				return ty, nil
+			}
+		}
+		return lookupType(outer, n)
+	}
 
+	// For each Type decl, recursively create the types.
 
-func containsInvalidTypeRecursion(named *GNamedType, t GType) bool {
-    switch t := t.(type) {
-        case *GPointer:
-            return false
-        case *GArray:
-            return containsInvalidTypeRecursion(named,t.SubType)
-        case *GStruct:
-            for _,ty := range t.Types {
-                if containsInvalidTypeRecursion(named,ty) {
-                    return true
-                }
-            }
-            return false
-        case *GNamedType:
-            return t == named
-    }
-    panic(t)
+	for _, td := range decls {
+		if tdLookup[td.Name] != td {
+			continue
+		}
+		if e, ok := td.Type.(*parse.Enum); ok {
+			tyLookup[td.Name].Type = enumToGType(e)
+			continue
+		}
+		t, err := astNodeToGType(lookup, td.Type)
+		tyLookup[td.Name].Type = t
+		if err != nil {
+			diags = append(diags, err)
+		}
+	}
+
+	// For each GType ensure it does not contain itself in a non reference form.
+
+	for _, ty := range ret {
+		if containsInvalidTypeRecursion(ty, ty.Type, make(map[*GNamedType]struct{})) {
+			td := tdLookup[ty.Name]
+			diags = append(diags, parse.Errorf(td.GetSpan(), "self recursive type %s", ty.Name))
+			// Break the cycle so later passes terminate.
+			ty.Type = nil
+		}
+	}
+
+	return ret, diags
 }
 
+// Enums have the same representation as a C enum.
+func enumToGType(e *parse.Enum) *GEnum {
+	ret := &GEnum{Type: builtinInt32GType.(*GInt)}
+	for _, m := range e.Members {
+		ret.Members = append(ret.Members, m.Val)
+	}
+	return ret
+}
 
+// Lookup an ident or a package qualified name in a type position.
+func lookupType(sc scope, n parse.Node) (GType, *parse.Diagnostic) {
+	var sym Symbol
+	var name string
+	switch n := n.(type) {
+	case *parse.Ident:
+		name = n.Val
+		s, err := sc.lookupSym(n.Val)
+		if err == nil {
+			sym = unwrapLazy(s)
+		}
+	case *parse.Selector:
+		name = qualifiedName(n)
+		s, isQualified, diag := lookupQualified(sc, n)
+		if diag != nil {
+			return nil, diag
+		}
+		if !isQualified {
+			return nil, parse.Errorf(n.GetSpan(), "%s is not a type", name)
+		}
+		sym = s
+	}
+	if sym == nil {
+		return nil, parse.Errorf(n.GetSpan(), "undefined type %s", name)
+	}
+	ts, ok := sym.(*TypeSymbol)
+	if !ok {
+		return nil, parse.Errorf(n.GetSpan(), "%s is not a type", name)
+	}
+	return ts.Type, nil
+}
 
+func containsInvalidTypeRecursion(named *GNamedType, t GType, visited map[*GNamedType]struct{}) bool {
+	switch t := t.(type) {
+	case *GPointer:
+		return false
+	case *GArray:
+		return containsInvalidTypeRecursion(named, t.SubType, visited)
+	case *GStruct:
+		for _, ty := range t.Types {
+			if containsInvalidTypeRecursion(named, ty, visited) {
+				return true
+			}
+		}
+		return false
+	case *GTuple:
+		for _, ty := range t.Types {
+			if containsInvalidTypeRecursion(named, ty, visited) {
+				return true
+			}
+		}
+		return false
+	case *GUnion:
+		for _, ty := range t.Types {
+			if containsInvalidTypeRecursion(named, ty, visited) {
+				return true
+			}
+		}
+		return false
+	case *GTaggedUnion:
+		for _, ty := range t.Types {
+			if containsInvalidTypeRecursion(named, ty, visited) {
+				return true
+			}
+		}
+		return false
+	case *GNamedType:
+		if t == named {
+			return true
+		}
+		_, ok := visited[t]
+		if ok {
+			return false
+		}
+		visited[t] = struct{}{}
+		return containsInvalidTypeRecursion(named, t.Type, visited)
+	case *GInt, *GFloat, *GVoid, *GFunc, *GEnum, nil:
+		return false
+	}
+	panic(t)
+}
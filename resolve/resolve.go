@@ -1,26 +1,142 @@
 package resolve
 
 import (
+	"fmt"
 	"github.com/andrewchambers/g/parse"
+	"github.com/andrewchambers/g/target"
+	"math/big"
 )
 
 // Resolver walks the package AST and resolves all symbols to either
 // types, global variables, local variables, or constants.
+//
+// Problems in the source are accumulated as diagnostics so that a
+// single run reports as many errors as possible.
 
 type Resolver struct {
-	ps *packageScope
-	ls *localScope
-	kv map[*parse.Ident]symbol
+	machine  target.TargetMachine
+	importer Importer
+	pkg      *Package
+	ps       *packageScope
+	ls       *localScope
+	kv       map[parse.Node]Symbol
+	types    []*GNamedType
+	// Types named inside expressions, such as the type of a composite
+	// literal or the type converted to by a conversion T(x).
+	typeExprs map[parse.Node]GType
+
+	// Type checker state.
+	exprTypes map[parse.Node]GType
+	consts    map[parse.Node]interface{}
+	// Const declarations being checked (false) or already checked (true).
+	constDecls  map[*parse.ConstDecl]bool
+	curFunc     *FuncSymbol
+	loopDepth   int
+	switchDepth int
+	deferDepth  int
+	// The selector being assigned to, which may select a tagged union variant.
+	variantTarget parse.Node
+
+	diags parse.DiagnosticList
 }
 
-func New() *Resolver {
+// Imports are resolved with importer, which may be nil if the package
+// has no imports.
+func New(machine target.TargetMachine, importer Importer) *Resolver {
 	ret := &Resolver{}
+	ret.machine = machine
+	ret.importer = importer
 	ret.ps = newPackageScope()
+	ret.kv = make(map[parse.Node]Symbol)
+	ret.typeExprs = make(map[parse.Node]GType)
+	ret.exprTypes = make(map[parse.Node]GType)
+	ret.consts = make(map[parse.Node]interface{})
+	ret.constDecls = make(map[*parse.ConstDecl]bool)
+	ret.declareBuiltins()
 	return ret
 }
 
-func (r *Resolver) ResolvePackage(files []*parse.File) {
+func (r *Resolver) declareBuiltins() {
+	builtinTypes := []struct {
+		name string
+		t    GType
+	}{
+		{"void", builtinVoidGType},
+		{"bool", builtinBoolGType},
+		{"int", getDefaultIntType(r.machine)},
+		{"int8", builtinInt8GType},
+		{"int16", builtinInt16GType},
+		{"int32", builtinInt32GType},
+		{"int64", builtinInt64GType},
+		{"uint", getUintType(r.machine)},
+		{"uint8", builtinUInt8GType},
+		{"byte", builtinUInt8GType},
+		{"uint16", builtinUInt16GType},
+		{"uint32", builtinUInt32GType},
+		{"uint64", builtinUInt64GType},
+		{"float32", builtinFloat32GType},
+		{"float64", builtinFloat64GType},
+		{"char", builtinCharGType},
+		{"uintptr", getUintptrType(r.machine)},
+	}
+	for _, bt := range builtinTypes {
+		err := r.ps.declareSym(bt.name, &TypeSymbol{bt.name, bt.t})
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, name := range []string{"sizeof", "alignof", "offsetof"} {
+		err := r.ps.declareSym(name, &BuiltinSymbol{Name: name})
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, b := range []bool{true, false} {
+		name := fmt.Sprintf("%v", b)
+		err := r.ps.declareSym(name, &ConstSymbol{Name: name, Type: builtinBoolGType, Val: b})
+		if err != nil {
+			panic(err)
+		}
+	}
+	err := r.ps.declareSym("nil", &ConstSymbol{Name: "nil", Type: &GNil{}})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Returns the symbol an Ident refers to, the symbol declared
+// by a VarDecl or FuncDecl, or the variable bound by a match case.
+// Returns nil if there is no such symbol.
+func (r *Resolver) Lookup(n parse.Node) Symbol {
+	return r.kv[n]
+}
+
+// Returns all the named types declared at package level.
+func (r *Resolver) NamedTypes() []*GNamedType {
+	return r.types
+}
+
+// Resolve and type check a package with the given import path, the path
+// of package main is ignored. If there are any problems the returned error
+// is a parse.DiagnosticList sorted by position.
+func (r *Resolver) ResolvePackage(path string, files []*parse.File) error {
+	r.pkg = &Package{
+		Exports: make(map[string]Symbol),
+		Types:   make(map[string]*GNamedType),
+	}
+	if len(files) != 0 {
+		r.pkg.Name = files[0].Pkg
+	}
+	if r.pkg.Name != "main" {
+		r.pkg.Path = path
+	}
+	for _, f := range files {
+		if f.Pkg != r.pkg.Name {
+			r.errorf(f.Span, "found package %s, expected %s", f.Pkg, r.pkg.Name)
+		}
+	}
 
+	r.resolveImports(files)
 	r.resolvePackageScope(files)
 
 	for _, f := range files {
@@ -28,51 +144,135 @@ func (r *Resolver) ResolvePackage(files []*parse.File) {
 			r.resolveFuncDecl(fd)
 		}
 	}
+
+	r.checkPackage(files)
+	if len(r.diags) != 0 {
+		r.diags.Sort()
+		return r.diags
+	}
+	r.collectExports()
+	return nil
+}
+
+func (r *Resolver) errorf(span parse.FileSpan, format string, args ...interface{}) {
+	r.diags = append(r.diags, parse.Errorf(span, format, args...))
+}
+
+// Declare a symbol, reporting redefinitions at span.
+func (r *Resolver) declare(sc scope, name string, sym Symbol, span parse.FileSpan) bool {
+	err := sc.declareSym(name, sym)
+	if err != nil {
+		r.errorf(span, "%s", err)
+		return false
+	}
+	return true
 }
 
 func (r *Resolver) resolvePackageScope(files []*parse.File) {
-	
-	var allTypeDecls [] *parse.TypeDecl
-    for _,f := range files {
-        for _,td := range f.TypeDecls {
-            allTypeDecls = append(allTypeDecls, td)
-        }
-    }	
-    
-    _, err := getTopLevelNamedTypes(allTypeDecls)
-    if err != nil {
-        panic(err)
-    }
-    
+
+	var allTypeDecls []*parse.TypeDecl
+	for _, f := range files {
+		for _, td := range f.TypeDecls {
+			allTypeDecls = append(allTypeDecls, td)
+		}
+	}
+
+	types, diags := getTopLevelNamedTypes(r.pkg.Path, allTypeDecls, r.ps)
+	r.diags = append(r.diags, diags...)
+	r.types = types
+	tdLookup := make(map[string]*parse.TypeDecl)
+	for _, td := range allTypeDecls {
+		if _, ok := tdLookup[td.Name]; !ok {
+			tdLookup[td.Name] = td
+		}
+	}
+	for _, t := range types {
+		r.declare(r.ps, t.Name, &TypeSymbol{t.Name, t}, tdLookup[t.Name].GetSpan())
+	}
+
+	// Enum members are constants of the enum type.
+	for _, t := range types {
+		e, ok := tdLookup[t.Name].Type.(*parse.Enum)
+		if !ok {
+			continue
+		}
+		for idx, m := range e.Members {
+			r.declare(r.ps, m.Val, &ConstSymbol{Name: m.Val, Type: t, Val: big.NewInt(int64(idx))}, m.Span)
+		}
+	}
+
+	for _, f := range files {
+		r.resolvePackageLevel(f)
+	}
+
+	// Global initializers may refer to any package level symbol.
+	for _, f := range files {
+		for _, vd := range f.VarDecls {
+			if vd.Init != nil {
+				r.ls = newLocalScope(r.ps)
+				r.resolveFuncBodyNode(vd.Init.R)
+			}
+		}
+		for _, cd := range f.ConstDecls {
+			r.ls = newLocalScope(r.ps)
+			r.resolveFuncBodyNode(cd.Body)
+		}
+	}
+	r.ls = nil
 }
 
 func (r *Resolver) resolvePackageLevel(f *parse.File) {
 
 	for _, fd := range f.FuncDecls {
-		fs := &funcSymbol{fd}
-		err := r.ps.declareSym(fd.Name, fs)
-		if err != nil {
-			panic(err)
-		}
+		fs := &FuncSymbol{Name: fd.Name, Decl: fd, Type: r.funcDeclToGType(fd), Pkg: r.pkg.Path}
+		r.declare(r.ps, fd.Name, fs, fd.Span)
+		r.kv[fd] = fs
 	}
-}
 
-func (r *Resolver) resolveType(sc scope, n parse.Node) {
-	switch n := n.(type) {
-	case *parse.Ident:
-		_, err := sc.lookupSym(n.Val)
-		if err != nil {
-			panic(err)
+	for _, cd := range f.ConstDecls {
+		cs := &ConstSymbol{Name: cd.Name, Decl: cd}
+		if cd.Type != nil {
+			cs.Type = r.resolveType(r.ps, cd.Type)
 		}
-	case *parse.Struct:
-		for idx := range n.Types {
-			r.resolveType(sc, n.Types[idx])
+		r.declare(r.ps, cd.Name, cs, cd.Span)
+		r.kv[cd] = cs
+	}
+
+	for _, vd := range f.VarDecls {
+		// Without a declared type the type checker infers one.
+		gs := &GlobalSymbol{Name: vd.Name, Decl: vd, Pkg: r.pkg.Path}
+		if vd.Type != nil {
+			gs.Type = r.resolveType(r.ps, vd.Type)
 		}
-	case *parse.PointerTo:
-		r.resolveType(sc, n.PointsTo)
-	default:
-		panic(n)
+		r.declare(r.ps, vd.Name, gs, vd.Span)
+		r.kv[vd] = gs
+	}
+}
+
+func (r *Resolver) funcDeclToGType(fd *parse.FuncDecl) *GFunc {
+	ret := &GFunc{}
+	for _, t := range fd.ArgTypes {
+		ret.ArgTypes = append(ret.ArgTypes, r.resolveType(r.ps, t))
+	}
+	if fd.RetType != nil {
+		ret.RetType = r.resolveType(r.ps, fd.RetType)
+	} else {
+		ret.RetType = builtinVoidGType
+	}
+	return ret
+}
+
+// Returns nil if the type is invalid, the error has already been reported.
+func (r *Resolver) resolveType(sc scope, n parse.Node) GType {
+	lookup := func(n parse.Node) (GType, *parse.Diagnostic) {
+		return lookupType(sc, n)
 	}
+	t, err := astNodeToGType(lookup, n)
+	if err != nil {
+		r.diags = append(r.diags, err)
+		return nil
+	}
+	return t
 }
 
 func (r *Resolver) pushScope() {
@@ -87,15 +287,81 @@ func (r *Resolver) resolveFuncDecl(fd *parse.FuncDecl) {
 	funcScope := newLocalScope(r.ps)
 	r.ls = funcScope
 
+	fs := r.kv[fd].(*FuncSymbol)
+	for idx, name := range fd.ArgNames {
+		if name == "" {
+			continue
+		}
+		r.declare(r.ls, name, &ArgSymbol{fd, idx, fs.Type.ArgTypes[idx]}, fd.ArgTypes[idx].GetSpan())
+	}
+
+	r.pushScope()
 	for _, n := range fd.Body {
 		r.resolveFuncBodyNode(n)
 	}
+	r.popScope()
 
 	if r.ls != funcScope {
 		panic("internal error")
 	}
 }
 
+// Returns the type node called by a conversion T(x), or false if the callee
+// is not a type. A parenthesized pointer type like (*T)(x) parses as a
+// dereference, it is rewritten as a pointer type.
+func (r *Resolver) conversionTypeNode(n parse.Node) (parse.Node, bool) {
+	switch n := n.(type) {
+	case *parse.Ident:
+		sym, err := r.ls.lookupSym(n.Val)
+		if err != nil {
+			return nil, false
+		}
+		_, ok := unwrapLazy(sym).(*TypeSymbol)
+		return n, ok
+	case *parse.Selector:
+		sym, isQualified, _ := lookupQualified(r.ls, n)
+		_, ok := sym.(*TypeSymbol)
+		return n, isQualified && ok
+	case *parse.Unop:
+		if n.Op != '*' {
+			return nil, false
+		}
+		sub, ok := r.conversionTypeNode(n.Expr)
+		if !ok {
+			return nil, false
+		}
+		ret := &parse.PointerTo{PointsTo: sub}
+		ret.Span = n.Span
+		return ret, true
+	case *parse.ArrayOf, *parse.PointerTo, *parse.Struct, *parse.Union, *parse.TupleOf:
+		return n, true
+	}
+	return nil, false
+}
+
+// The first argument of a builtin may be a type, and the second argument
+// of offsetof is a field name.
+func (r *Resolver) resolveBuiltinArg(b *BuiltinSymbol, idx int, arg parse.Node) {
+	if idx == 0 {
+		if t, ok := r.conversionTypeNode(arg); ok {
+			r.typeExprs[arg] = r.resolveType(r.ls, t)
+			return
+		}
+	}
+	if _, ok := arg.(*parse.Ident); ok && idx == 1 && b.Name == "offsetof" {
+		return
+	}
+	r.resolveFuncBodyNode(arg)
+}
+
+func unwrapLazy(sym Symbol) Symbol {
+	lazy, ok := sym.(*lazySymbol)
+	if ok {
+		return lazy.s
+	}
+	return sym
+}
+
 // Walk the function tree handling scopes and definitions while mapping ident
 // nodes to symbol objects.
 
@@ -107,15 +373,65 @@ func (r *Resolver) resolveFuncBodyNode(n parse.Node) {
 
 	switch n := n.(type) {
 	case *parse.VarDecl:
-		err := r.ls.declareSym(n.Name, &localSymbol{n})
-		if err != nil {
-			panic(err)
+		sym := &LocalSymbol{Decl: n}
+		if n.Type != nil {
+			sym.Type = r.resolveType(r.ls, n.Type)
+		}
+		// The initializer cannot refer to the variable being declared.
+		if n.Init != nil {
+			r.resolveFuncBodyNode(n.Init.R)
+		}
+		r.declare(r.ls, n.Name, sym, n.Span)
+		r.kv[n] = sym
+		if n.Init != nil {
+			r.resolveFuncBodyNode(n.Init.L)
+		}
+	case *parse.MultiVarDecl:
+		var declared []GType
+		if n.Type != nil {
+			t := r.resolveType(r.ls, n.Type)
+			tt, isTuple := underlying(t).(*GTuple)
+			switch {
+			case t == nil:
+			case isTuple && len(tt.Types) == len(n.Decls):
+				declared = tt.Types
+			case isTuple:
+				r.errorf(n.Type.GetSpan(), "%d variables declared with a tuple of %d types", len(n.Decls), len(tt.Types))
+			default:
+				for range n.Decls {
+					declared = append(declared, t)
+				}
+			}
+		}
+		if n.Init != nil {
+			r.resolveFuncBodyNode(n.Init.R)
+		}
+		for idx, vd := range n.Decls {
+			// Without a declared type the type checker infers one.
+			sym := &LocalSymbol{Decl: vd}
+			if declared != nil {
+				sym.Type = declared[idx]
+			}
+			r.declare(r.ls, vd.Name, sym, vd.Span)
+			r.kv[vd] = sym
+		}
+		if n.Init != nil {
+			r.resolveFuncBodyNode(n.Init.L)
+		}
+	case *parse.Tuple:
+		for _, elem := range n.Elems {
+			r.resolveFuncBodyNode(elem)
 		}
 	case *parse.Ident:
-		_, err := r.ls.lookupSym(n.Val)
-		if err != nil {
-			panic(err)
+		sym, err := r.ls.lookupSym(n.Val)
+		if err == nil {
+			sym = unwrapLazy(sym)
 		}
+		if err != nil || sym == nil {
+			r.errorf(n.Span, "undefined symbol %s", n.Val)
+			return
+		}
+		r.kv[n] = sym
 	case *parse.Assign:
 		r.resolveFuncBodyNode(n.L)
 		r.resolveFuncBodyNode(n.R)
@@ -129,10 +445,12 @@ func (r *Resolver) resolveFuncBodyNode(n parse.Node) {
 		r.resolveFuncBodyNode(n.Init)
 		r.resolveFuncBodyNode(n.Cond)
 		r.resolveFuncBodyNode(n.Step)
+		r.pushScope()
 		for _, sub := range n.Body {
 			r.resolveFuncBodyNode(sub)
 		}
 		r.popScope()
+		r.popScope()
 	case *parse.If:
 		r.resolveFuncBodyNode(n.Cond)
 		r.pushScope()
@@ -145,14 +463,92 @@ func (r *Resolver) resolveFuncBodyNode(n parse.Node) {
 			r.resolveFuncBodyNode(sub)
 		}
 		r.popScope()
+	case *parse.Switch:
+		r.resolveFuncBodyNode(n.Expr)
+		for _, c := range n.Cases {
+			for _, v := range c.Values {
+				r.resolveFuncBodyNode(v)
+			}
+			r.pushScope()
+			for _, sub := range c.Body {
+				r.resolveFuncBodyNode(sub)
+			}
+			r.popScope()
+		}
+	case *parse.Match:
+		r.resolveFuncBodyNode(n.Expr)
+		for _, c := range n.Cases {
+			r.pushScope()
+			// Variant names are not symbols, they are checked against
+			// the type of the matched expression.
+			ident, isIdent := n.Expr.(*parse.Ident)
+			if isIdent && len(c.Values) == 1 {
+				sym := &MatchVarSymbol{Match: n, Case: c}
+				r.declare(r.ls, ident.Val, sym, ident.Span)
+				r.kv[c] = sym
+			}
+			for _, sub := range c.Body {
+				r.resolveFuncBodyNode(sub)
+			}
+			r.popScope()
+		}
+	case *parse.Defer:
+		// The block sees the locals declared before it.
+		r.pushScope()
+		for _, sub := range n.Body {
+			r.resolveFuncBodyNode(sub)
+		}
+		r.popScope()
+	case *parse.CaseRange:
+		r.resolveFuncBodyNode(n.Low)
+		r.resolveFuncBodyNode(n.High)
 	case *parse.ExpressionStatement:
 		r.resolveFuncBodyNode(n.Expr)
 	case *parse.Call:
-		r.resolveFuncBodyNode(n.FuncLike)
-		for _, arg := range n.Args {
-			r.resolveFuncBodyNode(arg)
+		// A call of a type is a conversion.
+		if t, ok := r.conversionTypeNode(n.FuncLike); ok {
+			r.typeExprs[n] = r.resolveType(r.ls, t)
+		} else {
+			r.resolveFuncBodyNode(n.FuncLike)
+		}
+		b, isBuiltin := r.kv[n.FuncLike].(*BuiltinSymbol)
+		for idx, arg := range n.Args {
+			if isBuiltin {
+				r.resolveBuiltinArg(b, idx, arg)
+			} else {
+				r.resolveFuncBodyNode(arg)
+			}
+		}
+	case *parse.Return:
+		r.resolveFuncBodyNode(n.Expr)
+	case *parse.IndexInto:
+		r.resolveFuncBodyNode(n.Expr)
+		r.resolveFuncBodyNode(n.Index)
+	case *parse.Selector:
+		sym, isQualified, diag := lookupQualified(r.ls, n)
+		switch {
+		case diag != nil:
+			r.diags = append(r.diags, diag)
+		case isQualified:
+			r.kv[n] = sym
+		default:
+			r.resolveFuncBodyNode(n.Expr)
+		}
+	case *parse.Initializer:
+		if n.Type != nil {
+			r.typeExprs[n] = r.resolveType(r.ls, n.Type)
+		}
+		for _, sub := range n.Sub {
+			r.resolveFuncBodyNode(sub)
 		}
+	case *parse.New:
+		r.typeExprs[n] = r.resolveType(r.ls, n.Type)
+	case *parse.KeyValue:
+		// Keys name fields, they are checked against the literal's type.
+		r.resolveFuncBodyNode(n.Val)
+	case *parse.Constant, *parse.FloatConstant, *parse.String, *parse.EmptyStatement, *parse.Break, *parse.Continue:
+		// Nothing to resolve.
 	default:
-		panic(n)
+		r.errorf(n.GetSpan(), "unsupported syntax")
 	}
 }
@@ -6,28 +6,28 @@ import (
 )
 
 type scope interface {
-	declareSym(k string, s symbol) error
-	lookupSym(k string) (symbol, error)
+	declareSym(k string, s Symbol) error
+	lookupSym(k string) (Symbol, error)
 }
 
 type packageScope struct {
 	unresolved map[string]*lazySymbol
-	symkv      map[string]symbol
+	symkv      map[string]Symbol
 }
 
 type localScope struct {
 	parent scope
-	symkv  map[string]symbol
+	symkv  map[string]Symbol
 }
 
 func newPackageScope() *packageScope {
 	return &packageScope{
 		unresolved: make(map[string]*lazySymbol),
-		symkv:      make(map[string]symbol),
+		symkv:      make(map[string]Symbol),
 	}
 }
 
-func (s *packageScope) declareSym(k string, sym symbol) error {
+func (s *packageScope) declareSym(k string, sym Symbol) error {
 	_, ok := s.symkv[k]
 	if ok {
 		_, ok = s.unresolved[k]
@@ -46,7 +46,7 @@ func (s *packageScope) declareSym(k string, sym symbol) error {
 	return nil
 }
 
-func (s *packageScope) lookupSym(k string) (symbol, error) {
+func (s *packageScope) lookupSym(k string) (Symbol, error) {
 	sym, ok := s.symkv[k]
 	if ok {
 		return sym, nil
@@ -60,11 +60,11 @@ func (s *packageScope) lookupSym(k string) (symbol, error) {
 func newLocalScope(parent scope) *localScope {
 	s := &localScope{}
 	s.parent = parent
-	s.symkv = make(map[string]symbol)
+	s.symkv = make(map[string]Symbol)
 	return s
 }
 
-func (s *localScope) declareSym(k string, sym symbol) error {
+func (s *localScope) declareSym(k string, sym Symbol) error {
 	_, ok := s.symkv[k]
 	if ok {
 		return fmt.Errorf("redefinition of %s", k)
@@ -73,7 +73,7 @@ func (s *localScope) declareSym(k string, sym symbol) error {
 	return nil
 }
 
-func (s *localScope) lookupSym(k string) (symbol, error) {
+func (s *localScope) lookupSym(k string) (Symbol, error) {
 	v, ok := s.symkv[k]
 	if ok {
 		return v, nil
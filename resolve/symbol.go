@@ -11,27 +11,71 @@ const (
 	PACKAGE
 )
 
-type symbol interface{}
+// A Symbol is anything an identifier can resolve to.
+type Symbol interface{}
 
 type lazySymbol struct {
-	s symbol
+	s Symbol
 }
 
-type typeSymbol struct {
-	Decl *parse.TypeDecl
+type TypeSymbol struct {
+	Name string
 	Type GType
 }
 
-type localSymbol struct {
+type LocalSymbol struct {
 	Decl *parse.VarDecl
+	Type GType
+}
+
+type ArgSymbol struct {
+	Func *parse.FuncDecl
+	Idx  int
+	Type GType
+}
+
+// Constants declared with const have a Decl, their Type and Val are
+// filled in by the type checker. Type is GConstant for untyped constants.
+type ConstSymbol struct {
+	Name string
+	Type GType
+	Val  interface{}
+	Decl *parse.ConstDecl
 }
 
-type constSymbol struct {
+// Inside a match case the matched variable refers to the
+// payload of the variant being matched.
+type MatchVarSymbol struct {
+	Match *parse.Match
+	Case  *parse.SwitchCase
+	Type  GType
 }
 
-type globalSymbol struct {
+// Builtin functions like sizeof are evaluated by the type checker,
+// their arguments may be types.
+type BuiltinSymbol struct {
+	Name string
 }
 
-type funcSymbol struct {
+// Globals and functions record the import path of their package, which
+// is empty for package main. Decl is nil when they were read from the
+// export data of an imported package.
+type GlobalSymbol struct {
+	Name string
+	Decl *parse.VarDecl
+	Type GType
+	Pkg  string
+}
+
+type FuncSymbol struct {
+	Name string
 	Decl *parse.FuncDecl
+	Type *GFunc
+	Pkg  string
+}
+
+// An imported package, its exports are selected with pkg.Name.
+// Pkg is nil if the import failed.
+type PackageSymbol struct {
+	Pkg *Package
 }
@@ -0,0 +1,70 @@
+package resolve
+
+import (
+	"github.com/andrewchambers/g/parse"
+)
+
+// A function with a result must not run off the end of its body. Like Go
+// this is decided from the statements alone: the body must end with a
+// terminating statement, one which control cannot continue past.
+//
+// A return terminates, as does an if with an else where both branches
+// terminate, and a for without a condition which is never broken out of.
+// A switch or match terminates if it has a default, every case terminates
+// and none breaks out of it. A match without a default is exhaustive, but
+// like a switch on an enum it is not assumed to terminate.
+
+func isTerminatingList(l []parse.Node) bool {
+	for idx := len(l) - 1; idx >= 0; idx-- {
+		if _, isEmpty := l[idx].(*parse.EmptyStatement); !isEmpty {
+			return isTerminating(l[idx])
+		}
+	}
+	return false
+}
+
+func isTerminating(n parse.Node) bool {
+	switch n := n.(type) {
+	case *parse.Return:
+		return true
+	case *parse.If:
+		return isTerminatingList(n.Body) && isTerminatingList(n.Els)
+	case *parse.For:
+		return n.Cond == nil && !hasBreak(n.Body)
+	case *parse.Switch:
+		return casesTerminate(n.Cases)
+	case *parse.Match:
+		return casesTerminate(n.Cases)
+	}
+	return false
+}
+
+func casesTerminate(cases []*parse.SwitchCase) bool {
+	hasDefault := false
+	for _, c := range cases {
+		if c.IsDefault {
+			hasDefault = true
+		}
+		if !isTerminatingList(c.Body) || hasBreak(c.Body) {
+			return false
+		}
+	}
+	return hasDefault
+}
+
+// Reports whether a break in the statements leaves the loop, switch or
+// match they are the body of. A break inside a nested loop, switch or
+// match leaves that instead.
+func hasBreak(l []parse.Node) bool {
+	for _, n := range l {
+		switch n := n.(type) {
+		case *parse.Break:
+			return true
+		case *parse.If:
+			if hasBreak(n.Body) || hasBreak(n.Els) {
+				return true
+			}
+		}
+	}
+	return false
+}
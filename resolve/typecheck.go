@@ -0,0 +1,1433 @@
+package resolve
+
+import (
+	"fmt"
+	"github.com/andrewchambers/g/parse"
+	"math/big"
+	"strings"
+)
+
+// The type checker runs after symbol resolution. It assigns a GType to
+// every expression node, folds constant expressions and enforces that there
+// are no implicit conversions between types.
+//
+// Integer and float constants start out with the untyped GConstant type
+// and take on a concrete type from the context they are used in,
+// defaulting to int or float64.
+// nil has the untyped GNil type and must take a pointer type from its
+// context.
+
+// Returns the type of an expression, or nil if the node has no type.
+func (r *Resolver) TypeOf(n parse.Node) GType {
+	return r.exprTypes[n]
+}
+
+// Returns the value of a constant expression. The value is a *big.Int for
+// integer constants, a *big.Float for float constants, a bool for boolean
+// constants and nil for nil.
+func (r *Resolver) ConstantValue(n parse.Node) (interface{}, bool) {
+	v, ok := r.consts[n]
+	return v, ok
+}
+
+func (r *Resolver) checkPackage(files []*parse.File) {
+	// Globals are checked first so constants referring to them see their
+	// inferred types, the constants they use are checked on demand.
+	for _, f := range files {
+		for _, vd := range f.VarDecls {
+			r.checkVarDecl(vd)
+			if vd.Init != nil {
+				if !r.isConstant(vd.Init.R) && r.exprTypes[vd.Init.R] != nil {
+					r.errorf(vd.Init.R.GetSpan(), "initializer of global %s is not constant", vd.Name)
+				}
+			}
+		}
+	}
+	for _, f := range files {
+		for _, cd := range f.ConstDecls {
+			r.checkConstDecl(cd)
+		}
+	}
+	for _, f := range files {
+		for _, fd := range f.FuncDecls {
+			r.checkFuncDecl(fd)
+		}
+	}
+}
+
+// Constants may refer to constants declared after them, so each
+// declaration is checked when first used.
+func (r *Resolver) checkConstDecl(cd *parse.ConstDecl) {
+	done, seen := r.constDecls[cd]
+	if done {
+		return
+	}
+	sym := r.kv[cd].(*ConstSymbol)
+	if seen {
+		r.errorf(cd.Span, "constant definition loop involving %s", cd.Name)
+		sym.Type = nil
+		return
+	}
+	r.constDecls[cd] = false
+	defer func() {
+		r.constDecls[cd] = true
+	}()
+	// Constant initializers are checked outside of any function.
+	curFunc := r.curFunc
+	r.curFunc = nil
+	defer func() {
+		r.curFunc = curFunc
+	}()
+	if cd.Type != nil {
+		if sym.Type == nil {
+			return
+		}
+		r.checkAssignable(sym.Type, cd.Body, "constant declaration")
+	} else {
+		t := r.checkExpr(cd.Body)
+		if t != nil && isNil(t) {
+			r.errorf(cd.Body.GetSpan(), "cannot infer the type of %s from untyped nil", cd.Name)
+			t = nil
+		}
+		sym.Type = t
+	}
+	if r.exprTypes[cd.Body] == nil {
+		sym.Type = nil
+		return
+	}
+	v, isConst := r.consts[cd.Body]
+	if !isConst {
+		r.errorf(cd.Body.GetSpan(), "value of constant %s is not constant", cd.Name)
+		sym.Type = nil
+		return
+	}
+	sym.Val = v
+}
+
+func (r *Resolver) checkFuncDecl(fd *parse.FuncDecl) {
+	r.curFunc = r.kv[fd].(*FuncSymbol)
+	for _, n := range fd.Body {
+		r.checkStatement(n)
+	}
+	retType := r.curFunc.Type.RetType
+	if retType != nil && !isVoid(retType) && !isTerminatingList(fd.Body) {
+		r.errorf(fd.RBrace, "missing return")
+	}
+	r.curFunc = nil
+}
+
+func symbolType(sym Symbol) GType {
+	switch sym := sym.(type) {
+	case *LocalSymbol:
+		return sym.Type
+	case *ArgSymbol:
+		return sym.Type
+	case *GlobalSymbol:
+		return sym.Type
+	case *MatchVarSymbol:
+		return sym.Type
+	case *ConstSymbol:
+		return sym.Type
+	case *FuncSymbol:
+		return &GPointer{PointsTo: sym.Type}
+	}
+	return nil
+}
+
+func (r *Resolver) checkVarDecl(vd *parse.VarDecl) {
+	if vd.Type == nil {
+		r.inferVarDecl(vd)
+		return
+	}
+	t := symbolType(r.kv[vd])
+	if vd.Init != nil {
+		r.exprTypes[vd.Init.L] = t
+		r.checkAssignable(t, vd.Init.R, "variable declaration")
+	}
+}
+
+// Give a variable declared without a type the type of its initializer.
+func (r *Resolver) inferVarDecl(vd *parse.VarDecl) {
+	t := r.checkExpr(vd.Init.R)
+	if t == nil {
+		return
+	}
+	if _, isNil := t.(*GNil); isNil {
+		r.errorf(vd.Init.R.GetSpan(), "cannot infer the type of %s from untyped nil", vd.Name)
+		return
+	}
+	if isVoid(t) {
+		r.errorf(vd.Init.R.GetSpan(), "void value used in variable declaration")
+		return
+	}
+	r.defaultUntyped(vd.Init.R)
+	t = r.exprTypes[vd.Init.R]
+	switch sym := r.kv[vd].(type) {
+	case *LocalSymbol:
+		sym.Type = t
+	case *GlobalSymbol:
+		sym.Type = t
+	}
+	r.exprTypes[vd.Init.L] = t
+}
+
+func (r *Resolver) checkMultiVarDecl(m *parse.MultiVarDecl) {
+	if m.Init == nil {
+		return
+	}
+	var to []GType
+	for _, vd := range m.Decls {
+		to = append(to, symbolType(r.kv[vd]))
+	}
+	types := r.checkDestructure(to, m.Init.R, "variable declaration")
+	for idx, vd := range m.Decls {
+		sym := r.kv[vd].(*LocalSymbol)
+		if sym.Type == nil && types != nil {
+			sym.Type = types[idx]
+		}
+		r.exprTypes[m.Init.L.(*parse.Tuple).Elems[idx]] = sym.Type
+	}
+}
+
+// Check the values of rhs can be assigned to len(to) destinations. A nil
+// destination type is inferred from the value. Returns the type of each
+// value, or nil if there was an error.
+func (r *Resolver) checkDestructure(to []GType, rhs parse.Node, what string) []GType {
+	tup, isLiteral := rhs.(*parse.Tuple)
+	if isLiteral {
+		if len(tup.Elems) != len(to) {
+			r.errorf(rhs.GetSpan(), "assignment mismatch: %d variables but %d values", len(to), len(tup.Elems))
+			for _, elem := range tup.Elems {
+				r.checkExpr(elem)
+			}
+			return nil
+		}
+		ret := make([]GType, len(to))
+		ok := true
+		for idx, elem := range tup.Elems {
+			if to[idx] != nil {
+				r.checkAssignable(to[idx], elem, what)
+				ret[idx] = to[idx]
+				continue
+			}
+			t := r.checkExpr(elem)
+			if t == nil {
+				ok = false
+				continue
+			}
+			if isVoid(t) {
+				r.errorf(elem.GetSpan(), "void value used in %s", what)
+				ok = false
+				continue
+			}
+			r.defaultUntyped(elem)
+			ret[idx] = r.exprTypes[elem]
+		}
+		if !ok {
+			return nil
+		}
+		r.exprTypes[rhs] = &GTuple{Types: ret}
+		return ret
+	}
+	t := r.checkExpr(rhs)
+	if t == nil {
+		return nil
+	}
+	tt, ok := underlying(t).(*GTuple)
+	if !ok {
+		r.errorf(rhs.GetSpan(), "assignment mismatch: %d variables but 1 value", len(to))
+		return nil
+	}
+	if len(tt.Types) != len(to) {
+		r.errorf(rhs.GetSpan(), "assignment mismatch: %d variables but %d values", len(to), len(tt.Types))
+		return nil
+	}
+	for idx := range to {
+		if to[idx] != nil && !to[idx].Equals(tt.Types[idx]) {
+			r.errorf(rhs.GetSpan(), "cannot use value of type %s as type %s in %s", tt.Types[idx], to[idx], what)
+			return nil
+		}
+	}
+	return tt.Types
+}
+
+func (r *Resolver) checkStatement(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.VarDecl:
+		r.checkVarDecl(n)
+	case *parse.MultiVarDecl:
+		r.checkMultiVarDecl(n)
+	case *parse.Assign:
+		r.checkAssign(n)
+	case *parse.Return:
+		if r.deferDepth != 0 {
+			r.errorf(n.Span, "return inside defer block")
+			return
+		}
+		retType := r.curFunc.Type.RetType
+		if retType == nil {
+			if n.Expr != nil {
+				r.checkExpr(n.Expr)
+			}
+			return
+		}
+		if n.Expr == nil {
+			if !isVoid(retType) {
+				r.errorf(n.Span, "function expects a return value of type %s", retType)
+			}
+			return
+		}
+		if isVoid(retType) {
+			r.errorf(n.Span, "function does not return a value")
+			return
+		}
+		r.checkAssignable(retType, n.Expr, "return statement")
+	case *parse.If:
+		r.checkCondition(n.Cond, "if statement")
+		for _, sub := range n.Body {
+			r.checkStatement(sub)
+		}
+		for _, sub := range n.Els {
+			r.checkStatement(sub)
+		}
+	case *parse.For:
+		if n.Init != nil {
+			r.checkStatement(n.Init)
+		}
+		if n.Cond != nil {
+			r.checkCondition(n.Cond, "for loop condition")
+		}
+		if n.Step != nil {
+			r.checkStatement(n.Step)
+		}
+		r.loopDepth += 1
+		for _, sub := range n.Body {
+			r.checkStatement(sub)
+		}
+		r.loopDepth -= 1
+	case *parse.Defer:
+		// break and continue cannot leave a deferred block.
+		loopDepth, switchDepth := r.loopDepth, r.switchDepth
+		r.loopDepth, r.switchDepth = 0, 0
+		r.deferDepth += 1
+		for _, sub := range n.Body {
+			r.checkStatement(sub)
+		}
+		r.deferDepth -= 1
+		r.loopDepth, r.switchDepth = loopDepth, switchDepth
+	case *parse.Switch:
+		r.checkSwitch(n)
+	case *parse.Match:
+		r.checkMatch(n)
+	case *parse.Break:
+		if r.loopDepth == 0 && r.switchDepth == 0 {
+			r.errorf(n.Span, "break outside of loop")
+		}
+	case *parse.Continue:
+		if r.loopDepth == 0 {
+			r.errorf(n.Span, "continue outside of loop")
+		}
+	case *parse.ExpressionStatement:
+		if r.checkExpr(n.Expr) != nil {
+			r.defaultUntyped(n.Expr)
+		}
+	case *parse.EmptyStatement:
+	default:
+		r.errorf(n.GetSpan(), "unsupported statement")
+	}
+}
+
+// A case value covers the integer range [lo, hi].
+type caseInterval struct {
+	lo, hi *big.Int
+	span   parse.FileSpan
+}
+
+func (r *Resolver) checkSwitch(s *parse.Switch) {
+	var tagType GType
+	if s.Expr != nil {
+		tagType = r.checkExpr(s.Expr)
+		if tagType != nil {
+			r.defaultUntyped(s.Expr)
+			tagType = r.exprTypes[s.Expr]
+			if !isIntType(tagType) && !isEnum(tagType) {
+				r.errorf(s.Expr.GetSpan(), "cannot switch on type %s", tagType)
+				tagType = nil
+			}
+		}
+	}
+
+	var seen []caseInterval
+	var defaultCase *parse.SwitchCase
+	for _, c := range s.Cases {
+		if c.IsDefault {
+			if defaultCase != nil {
+				r.errorf(c.Span, "multiple defaults in switch, previous default at %s", defaultCase.Span.Start)
+			}
+			defaultCase = c
+		}
+		for _, v := range c.Values {
+			if s.Expr == nil {
+				if _, isRange := v.(*parse.CaseRange); isRange {
+					r.errorf(v.GetSpan(), "case range in switch without a value")
+					continue
+				}
+				r.checkCondition(v, "switch case")
+				continue
+			}
+			iv, ok := r.checkCaseValue(tagType, v)
+			if !ok {
+				continue
+			}
+			for _, prev := range seen {
+				if iv.lo.Cmp(prev.hi) > 0 || iv.hi.Cmp(prev.lo) < 0 {
+					continue
+				}
+				if iv.lo.Cmp(iv.hi) == 0 && prev.lo.Cmp(prev.hi) == 0 {
+					r.errorf(iv.span, "duplicate case %s in switch, previous case at %s", caseValueString(tagType, iv.lo), prev.span.Start)
+				} else {
+					r.errorf(iv.span, "case overlaps previous case at %s", prev.span.Start)
+				}
+				break
+			}
+			seen = append(seen, iv)
+		}
+		r.switchDepth += 1
+		for _, sub := range c.Body {
+			r.checkStatement(sub)
+		}
+		r.switchDepth -= 1
+	}
+
+	// Switches over enums must handle every member.
+	if tagType != nil && defaultCase == nil {
+		if e, ok := underlying(tagType).(*GEnum); ok {
+			var missing []string
+			for idx, m := range e.Members {
+				handled := false
+				for _, iv := range seen {
+					v := big.NewInt(int64(idx))
+					if iv.lo.Cmp(v) <= 0 && v.Cmp(iv.hi) <= 0 {
+						handled = true
+					}
+				}
+				if !handled {
+					missing = append(missing, m)
+				}
+			}
+			if len(missing) != 0 {
+				r.errorf(s.Span, "switch on %s does not handle %s", tagType, strings.Join(missing, ", "))
+			}
+		}
+	}
+}
+
+// Check a case value of a switch on type t, returning the values it covers.
+func (r *Resolver) checkCaseValue(t GType, v parse.Node) (caseInterval, bool) {
+	ret := caseInterval{span: v.GetSpan()}
+	bounds := []parse.Node{v}
+	rng, isRange := v.(*parse.CaseRange)
+	if isRange {
+		bounds = []parse.Node{rng.Low, rng.High}
+	}
+	var vals []*big.Int
+	for _, b := range bounds {
+		r.checkAssignable(t, b, "switch case")
+		// If the value could not be assigned, its type is not t.
+		if t == nil || r.exprTypes[b] == nil || !t.Equals(r.exprTypes[b]) {
+			return ret, false
+		}
+		c, isConst := r.consts[b]
+		if !isConst {
+			r.errorf(b.GetSpan(), "case value must be constant")
+			return ret, false
+		}
+		switch c := c.(type) {
+		case *big.Int:
+			vals = append(vals, c)
+		case bool:
+			if isRange {
+				r.errorf(v.GetSpan(), "case range on non integer type %s", t)
+				return ret, false
+			}
+			if c {
+				vals = append(vals, big.NewInt(1))
+			} else {
+				vals = append(vals, big.NewInt(0))
+			}
+		}
+	}
+	ret.lo = vals[0]
+	ret.hi = vals[len(vals)-1]
+	if ret.lo.Cmp(ret.hi) > 0 {
+		r.errorf(v.GetSpan(), "empty case range %s..%s", ret.lo, ret.hi)
+		return ret, false
+	}
+	return ret, true
+}
+
+func caseValueString(t GType, v *big.Int) string {
+	if isBool(t) {
+		return fmt.Sprintf("%v", v.Sign() != 0)
+	}
+	if e, ok := underlying(t).(*GEnum); ok && v.IsInt64() && v.Int64() < int64(len(e.Members)) {
+		return e.Members[v.Int64()]
+	}
+	return v.String()
+}
+
+func (r *Resolver) checkMatch(m *parse.Match) {
+	t := r.checkExpr(m.Expr)
+	var u *GTaggedUnion
+	if t != nil {
+		var ok bool
+		u, ok = underlying(t).(*GTaggedUnion)
+		if !ok {
+			r.errorf(m.Expr.GetSpan(), "cannot match on type %s, expected a tagged union", t)
+		}
+	}
+
+	seen := make(map[int]parse.FileSpan)
+	var defaultCase *parse.SwitchCase
+	for _, c := range m.Cases {
+		if c.IsDefault {
+			if defaultCase != nil {
+				r.errorf(c.Span, "multiple defaults in match, previous default at %s", defaultCase.Span.Start)
+			}
+			defaultCase = c
+		}
+		for _, v := range c.Values {
+			ident, ok := v.(*parse.Ident)
+			if !ok {
+				r.errorf(v.GetSpan(), "match case must be a variant name")
+				continue
+			}
+			if u == nil {
+				continue
+			}
+			idx := u.VariantIndex(ident.Val)
+			if idx < 0 {
+				r.errorf(v.GetSpan(), "%s has no variant %s", t, ident.Val)
+				continue
+			}
+			if prev, dup := seen[idx]; dup {
+				r.errorf(v.GetSpan(), "duplicate case %s in match, previous case at %s", ident.Val, prev.Start)
+				continue
+			}
+			seen[idx] = v.GetSpan()
+			if sym, ok := r.kv[c].(*MatchVarSymbol); ok {
+				sym.Type = u.Types[idx]
+			}
+		}
+		r.switchDepth += 1
+		for _, sub := range c.Body {
+			r.checkStatement(sub)
+		}
+		r.switchDepth -= 1
+	}
+
+	if u != nil && defaultCase == nil {
+		var missing []string
+		for idx, name := range u.Names {
+			if _, ok := seen[idx]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) != 0 {
+			r.errorf(m.Span, "match on %s does not handle %s", t, strings.Join(missing, ", "))
+		}
+	}
+}
+
+func (r *Resolver) checkTupleAssign(ass *parse.Assign) {
+	l := ass.L.(*parse.Tuple)
+	if ass.Op != '=' {
+		r.errorf(ass.Span, "operator %s cannot assign to multiple values", ass.Op)
+	}
+	var to []GType
+	for _, elem := range l.Elems {
+		t := r.checkExpr(elem)
+		if t != nil && !r.isAddressable(elem) {
+			r.errorf(elem.GetSpan(), "cannot assign to a non lvalue")
+			t = nil
+		}
+		to = append(to, t)
+	}
+	r.checkDestructure(to, ass.R, "assignment")
+}
+
+func (r *Resolver) checkAssign(ass *parse.Assign) {
+	if _, ok := ass.L.(*parse.Tuple); ok {
+		r.checkTupleAssign(ass)
+		return
+	}
+	if ass.Op == '=' {
+		r.variantTarget = ass.L
+	}
+	lt := r.checkExpr(ass.L)
+	r.variantTarget = nil
+	if lt == nil {
+		r.checkExpr(ass.R)
+		return
+	}
+	if !r.isAddressable(ass.L) {
+		r.errorf(ass.L.GetSpan(), "cannot assign to a non lvalue")
+	}
+	switch ass.Op {
+	case '=':
+	case parse.ANDASSIGN, parse.ORASSIGN, parse.XORASSIGN:
+		if !isIntType(lt) {
+			r.errorf(ass.Span, "operator %s requires an integer or bool operand, got %s", ass.Op, lt)
+		}
+	default:
+		if !isNumeric(lt) {
+			r.errorf(ass.Span, "operator %s requires a numeric operand, got %s", ass.Op, lt)
+		}
+	}
+	r.checkAssignable(lt, ass.R, "assignment")
+}
+
+func (r *Resolver) checkCondition(n parse.Node, what string) {
+	t := r.checkExpr(n)
+	if t == nil {
+		return
+	}
+	if !isBool(t) {
+		r.errorf(n.GetSpan(), "%s requires a bool expression, got %s", what, t)
+	}
+}
+
+// Is n a constant expression, or a composite literal or tuple of constants.
+func (r *Resolver) isConstant(n parse.Node) bool {
+	var elems []parse.Node
+	switch n := n.(type) {
+	case *parse.String:
+		// The address of a string literal is a link time constant.
+		return true
+	case *parse.Initializer:
+		elems = n.Sub
+	case *parse.Tuple:
+		elems = n.Elems
+	default:
+		_, ok := r.consts[n]
+		return ok
+	}
+	for _, sub := range elems {
+		if kv, ok := sub.(*parse.KeyValue); ok {
+			sub = kv.Val
+		}
+		if !r.isConstant(sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check the elements of a composite literal of type t.
+func (r *Resolver) checkInitializer(lit *parse.Initializer, t GType) GType {
+	switch ut := underlying(t).(type) {
+	case *GStruct:
+		r.checkStructLiteral(lit, t, ut)
+	case *GArray:
+		if len(lit.Sub) > int(ut.Dim) {
+			r.errorf(lit.Span, "too many values in %s literal", t)
+		}
+		for _, sub := range lit.Sub {
+			if kv, ok := sub.(*parse.KeyValue); ok {
+				r.errorf(kv.Span, "array literal elements cannot be named")
+				continue
+			}
+			r.checkAssignable(ut.SubType, sub, "composite literal")
+		}
+	default:
+		r.errorf(lit.Span, "invalid composite literal type %s", t)
+		return nil
+	}
+	return t
+}
+
+// Struct literals either list every value in field order, or name the
+// fields they set. Omitted fields are zero.
+func (r *Resolver) checkStructLiteral(lit *parse.Initializer, t GType, st *GStruct) {
+	named := 0
+	for _, sub := range lit.Sub {
+		if _, ok := sub.(*parse.KeyValue); ok {
+			named += 1
+		}
+	}
+	if named == 0 {
+		if len(lit.Sub) > len(st.Types) {
+			r.errorf(lit.Span, "too many values in %s literal", t)
+			return
+		}
+		for idx, sub := range lit.Sub {
+			r.checkAssignable(st.Types[idx], sub, "composite literal")
+		}
+		return
+	}
+	if named != len(lit.Sub) {
+		r.errorf(lit.Span, "mixture of named and positional values in %s literal", t)
+		return
+	}
+	seen := make(map[int]bool)
+	for _, sub := range lit.Sub {
+		kv := sub.(*parse.KeyValue)
+		idx := st.FieldIndex(kv.Key.Val)
+		if idx < 0 {
+			r.errorf(kv.Key.Span, "unknown field %s in %s literal", kv.Key.Val, t)
+			continue
+		}
+		if seen[idx] {
+			r.errorf(kv.Key.Span, "duplicate field %s in %s literal", kv.Key.Val, t)
+			continue
+		}
+		seen[idx] = true
+		r.checkAssignable(st.Types[idx], kv.Val, "composite literal")
+	}
+}
+
+// Check the expression n can be assigned to something of type to.
+func (r *Resolver) checkAssignable(to GType, n parse.Node, what string) {
+	// A literal without a type takes the type it is assigned to.
+	if lit, ok := n.(*parse.Initializer); ok && lit.Type == nil {
+		if to != nil && r.checkInitializer(lit, to) != nil {
+			r.exprTypes[n] = to
+		}
+		return
+	}
+	tup, isLiteral := n.(*parse.Tuple)
+	tt, isTuple := underlying(to).(*GTuple)
+	if isLiteral && isTuple {
+		if len(tup.Elems) != len(tt.Types) {
+			r.errorf(n.GetSpan(), "expected %d values in %s, got %d", len(tt.Types), what, len(tup.Elems))
+			return
+		}
+		for idx, elem := range tup.Elems {
+			r.checkAssignable(tt.Types[idx], elem, what)
+		}
+		r.exprTypes[n] = to
+		return
+	}
+	t := r.checkExpr(n)
+	if t == nil || to == nil {
+		return
+	}
+	if isUntyped(t) {
+		r.convertUntyped(n, to)
+		return
+	}
+	if isVoid(t) {
+		r.errorf(n.GetSpan(), "void value used in %s", what)
+		return
+	}
+	if !to.Equals(t) {
+		r.errorf(n.GetSpan(), "cannot use value of type %s as type %s in %s", t, to, what)
+	}
+}
+
+func isUntyped(t GType) bool {
+	switch t.(type) {
+	case *GConstant, *GNil:
+		return true
+	}
+	return false
+}
+
+func isNil(t GType) bool {
+	_, ok := t.(*GNil)
+	return ok
+}
+
+// Is t an integer type or an untyped integer constant.
+func isInteger(t GType) bool {
+	c, isConst := t.(*GConstant)
+	return isConst && !c.Float || isIntType(t) && !isBool(t)
+}
+
+// Is t a float type or an untyped float constant.
+func isFloating(t GType) bool {
+	c, isConst := t.(*GConstant)
+	return isConst && c.Float || isFloat(t)
+}
+
+func isNumeric(t GType) bool {
+	return isInteger(t) || isFloating(t)
+}
+
+func constantString(v interface{}) string {
+	if f, ok := v.(*big.Float); ok {
+		return f.Text('g', 10)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Convert the value of an integer or float constant to type to. Like Go,
+// the value must be exactly representable, except that floats are rounded.
+func (r *Resolver) convertConstant(span parse.FileSpan, v interface{}, to GType) (interface{}, bool) {
+	switch ut := underlying(to).(type) {
+	case *GInt:
+		if isBool(ut) {
+			break
+		}
+		iv, ok := v.(*big.Int)
+		if f, isFloat := v.(*big.Float); isFloat {
+			iv, ok = floatToIntConstant(f)
+			if !ok {
+				r.errorf(span, "constant %s truncated to integer", constantString(v))
+				return nil, false
+			}
+		}
+		if !ok {
+			break
+		}
+		if !constantFitsInt(iv, ut) {
+			r.errorf(span, "constant %s overflows %s", iv, to)
+			return nil, false
+		}
+		return iv, true
+	case *GFloat:
+		f, ok := v.(*big.Float)
+		if iv, isInt := v.(*big.Int); isInt {
+			f, ok = intToFloatConstant(iv), true
+		}
+		if !ok {
+			break
+		}
+		rounded, ok := roundFloatConstant(f, ut)
+		if !ok {
+			r.errorf(span, "constant %s overflows %s", constantString(v), to)
+			return nil, false
+		}
+		return rounded, true
+	}
+	r.errorf(span, "cannot use constant %s as type %s", constantString(v), to)
+	return nil, false
+}
+
+// Give an untyped constant expression a concrete type.
+func (r *Resolver) convertUntyped(n parse.Node, to GType) bool {
+	if !isUntyped(r.exprTypes[n]) {
+		return true
+	}
+	if isNil(r.exprTypes[n]) {
+		if _, ok := underlying(to).(*GPointer); !ok {
+			r.errorf(n.GetSpan(), "cannot use nil as type %s", to)
+			return false
+		}
+		r.setUntypedType(n, to)
+		return true
+	}
+	v, ok := r.convertConstant(n.GetSpan(), r.consts[n], to)
+	if !ok {
+		return false
+	}
+	// Only the outermost constant of an expression is emitted, so
+	// only its value needs the representation of the new type.
+	r.consts[n] = v
+	r.setUntypedType(n, to)
+	return true
+}
+
+func (r *Resolver) setUntypedType(n parse.Node, to GType) {
+	if !isUntyped(r.exprTypes[n]) {
+		return
+	}
+	r.exprTypes[n] = to
+	switch n := n.(type) {
+	case *parse.Binop:
+		r.setUntypedType(n.L, to)
+		r.setUntypedType(n.R, to)
+	case *parse.Unop:
+		r.setUntypedType(n.Expr, to)
+	}
+}
+
+// Untyped constants with no other context become ints.
+func (r *Resolver) defaultUntyped(n parse.Node) {
+	if isNil(r.exprTypes[n]) {
+		r.errorf(n.GetSpan(), "use of untyped nil")
+		return
+	}
+	if c, ok := r.exprTypes[n].(*GConstant); ok && c.Float {
+		r.convertUntyped(n, builtinFloat64GType)
+	} else if isUntyped(r.exprTypes[n]) {
+		r.convertUntyped(n, getDefaultIntType(r.machine))
+	}
+}
+
+func (r *Resolver) isAddressable(n parse.Node) bool {
+	switch n := n.(type) {
+	case *parse.Ident:
+		return isVariable(r.kv[n])
+	case *parse.Unop:
+		return n.Op == '*'
+	case *parse.IndexInto:
+		_, isPtr := underlying(r.exprTypes[n.Expr]).(*GPointer)
+		return isPtr || r.isAddressable(n.Expr)
+	case *parse.Selector:
+		if sym, isQualified := r.kv[n]; isQualified {
+			return isVariable(sym)
+		}
+		_, isPtr := underlying(r.exprTypes[n.Expr]).(*GPointer)
+		return isPtr || r.isAddressable(n.Expr)
+	}
+	return false
+}
+
+func isVariable(sym Symbol) bool {
+	switch sym.(type) {
+	case *LocalSymbol, *ArgSymbol, *GlobalSymbol, *MatchVarSymbol:
+		return true
+	}
+	return false
+}
+
+// Compute and record the type of an expression. Returns nil if the
+// expression has an error which has already been reported.
+func (r *Resolver) checkExpr(n parse.Node) GType {
+	t := r.checkExpr2(n)
+	if t != nil {
+		r.exprTypes[n] = t
+	}
+	return t
+}
+
+func (r *Resolver) checkExpr2(n parse.Node) GType {
+	switch n := n.(type) {
+	case *parse.Constant:
+		r.consts[n] = n.Val
+		return &GConstant{}
+	case *parse.FloatConstant:
+		r.consts[n] = n.Val
+		return &GConstant{Float: true}
+	case *parse.String:
+		return &GPointer{PointsTo: builtinCharGType}
+	case *parse.Ident:
+		return r.checkSymbolRef(n, n.Val, r.kv[n])
+	case *parse.Binop:
+		return r.checkBinop(n)
+	case *parse.Unop:
+		return r.checkUnop(n)
+	case *parse.Call:
+		return r.checkCall(n)
+	case *parse.IndexInto:
+		return r.checkIndex(n)
+	case *parse.Selector:
+		if sym, isQualified := r.kv[n]; isQualified {
+			return r.checkSymbolRef(n, qualifiedName(n), sym)
+		}
+		return r.checkSelector(n)
+	case *parse.New:
+		t := r.typeExprs[n]
+		if t == nil {
+			return nil
+		}
+		if !hasLayout(t) {
+			r.errorf(n.Type.GetSpan(), "cannot allocate %s, it has no size", t)
+			return nil
+		}
+		return &GPointer{PointsTo: t}
+	case *parse.Initializer:
+		if n.Type == nil {
+			r.errorf(n.Span, "missing type in composite literal")
+			return nil
+		}
+		t := r.typeExprs[n]
+		if t == nil {
+			return nil
+		}
+		return r.checkInitializer(n, t)
+	case *parse.Tuple:
+		var types []GType
+		for _, elem := range n.Elems {
+			t := r.checkExpr(elem)
+			if t == nil {
+				return nil
+			}
+			if isVoid(t) {
+				r.errorf(elem.GetSpan(), "void value used in tuple")
+				return nil
+			}
+			r.defaultUntyped(elem)
+			types = append(types, r.exprTypes[elem])
+		}
+		return &GTuple{Types: types}
+	default:
+		r.errorf(n.GetSpan(), "unsupported expression")
+		return nil
+	}
+}
+
+// Make both operands of a binary operator have the same type.
+func (r *Resolver) unifyOperands(b *parse.Binop, lt, rt GType) GType {
+	if isUntyped(lt) && isUntyped(rt) {
+		if !lt.Equals(rt) || isNil(lt) {
+			r.errorf(b.Span, "operator %s cannot be performed on %s and %s", b.Op, lt, rt)
+			return nil
+		}
+		// An untyped int and float give an untyped float.
+		if rt.(*GConstant).Float {
+			return rt
+		}
+		return lt
+	}
+	if isUntyped(lt) {
+		if !r.convertUntyped(b.L, rt) {
+			return nil
+		}
+		return rt
+	}
+	if isUntyped(rt) {
+		if !r.convertUntyped(b.R, lt) {
+			return nil
+		}
+		return lt
+	}
+	if !lt.Equals(rt) {
+		r.errorf(b.Span, "mismatched types %s and %s for operator %s", lt, rt, b.Op)
+		return nil
+	}
+	return lt
+}
+
+func (r *Resolver) checkBinop(b *parse.Binop) GType {
+	lt := r.checkExpr(b.L)
+	rt := r.checkExpr(b.R)
+	if lt == nil || rt == nil {
+		return nil
+	}
+
+	var ret GType
+
+	switch b.Op {
+	case parse.AND, parse.OR:
+		if !isBool(lt) || !isBool(rt) {
+			r.errorf(b.Span, "operator %s requires bool operands", b.Op)
+			return nil
+		}
+		ret = r.unifyOperands(b, lt, rt)
+	case parse.LSHIFT, parse.RSHIFT:
+		if !isInteger(lt) || !isInteger(rt) {
+			r.errorf(b.Span, "operator %s requires integer operands", b.Op)
+			return nil
+		}
+		if isUntyped(rt) && !isUntyped(lt) {
+			r.defaultUntyped(b.R)
+		}
+		if isUntyped(lt) && !isUntyped(rt) {
+			r.defaultUntyped(b.L)
+		}
+		ret = r.exprTypes[b.L]
+	case parse.EQ, parse.NEQ, '<', parse.LTEQ, '>', parse.GTEQ:
+		t := r.unifyOperands(b, lt, rt)
+		if t == nil {
+			return nil
+		}
+		_, isPtr := underlying(t).(*GPointer)
+		isOrdered := b.Op != parse.EQ && b.Op != parse.NEQ
+		if isOrdered && !isNumeric(t) {
+			r.errorf(b.Span, "operator %s cannot be performed on type %s", b.Op, t)
+			return nil
+		}
+		if !isOrdered && !isPtr && !isIntType(t) && !isFloat(t) && !isEnum(t) && !isUntyped(t) {
+			r.errorf(b.Span, "operator %s cannot be performed on type %s", b.Op, t)
+			return nil
+		}
+		if isUntyped(t) {
+			r.defaultUntyped(b.L)
+			r.defaultUntyped(b.R)
+		}
+		ret = builtinBoolGType
+	default:
+		t := r.unifyOperands(b, lt, rt)
+		if t == nil {
+			return nil
+		}
+		if !isIntType(t) && !isUntyped(t) && !isFloat(t) {
+			r.errorf(b.Span, "operator %s cannot be performed on type %s", b.Op, t)
+			return nil
+		}
+		isArith := b.Op == '+' || b.Op == '-' || b.Op == '*' || b.Op == '/'
+		if isFloating(t) && !isArith {
+			r.errorf(b.Span, "operator %s cannot be performed on type %s", b.Op, t)
+			return nil
+		}
+		if isBool(t) && b.Op != '&' && b.Op != '|' && b.Op != '^' {
+			r.errorf(b.Span, "operator %s cannot be performed on type bool", b.Op)
+			return nil
+		}
+		ret = t
+	}
+
+	lv, lconst := r.consts[b.L]
+	rv, rconst := r.consts[b.R]
+	if ret != nil && lconst && rconst {
+		v, err := foldConstantBinop(b.Op, lv, rv)
+		if err != nil {
+			r.errorf(b.Span, "%s", err)
+			return nil
+		}
+		it, isInt := underlying(ret).(*GInt)
+		if iv, ok := v.(*big.Int); ok && isInt && !isBool(it) && !constantFitsInt(iv, it) {
+			r.errorf(b.Span, "constant %d overflows %s", iv, ret)
+			return nil
+		}
+		// Typed float arithmetic is rounded after each operation.
+		if ft, ok := underlying(ret).(*GFloat); ok {
+			rounded, ok := roundFloatConstant(v.(*big.Float), ft)
+			if !ok {
+				r.errorf(b.Span, "constant %s overflows %s", constantString(v), ret)
+				return nil
+			}
+			v = rounded
+		}
+		r.consts[b] = v
+	}
+	return ret
+}
+
+func (r *Resolver) checkUnop(u *parse.Unop) GType {
+	t := r.checkExpr(u.Expr)
+	if t == nil {
+		return nil
+	}
+	var ret GType
+	switch u.Op {
+	case '&':
+		// Composite literals are allocated with the allocator of new
+		// when their address is taken.
+		_, isLiteral := u.Expr.(*parse.Initializer)
+		if !isLiteral && !r.isAddressable(u.Expr) {
+			r.errorf(u.Span, "cannot take address of non lvalue")
+			return nil
+		}
+		return &GPointer{PointsTo: t}
+	case '*':
+		p, ok := underlying(t).(*GPointer)
+		if !ok {
+			r.errorf(u.Span, "cannot dereference non pointer type %s", t)
+			return nil
+		}
+		if isVoid(p.PointsTo) {
+			r.errorf(u.Span, "cannot dereference %s", t)
+			return nil
+		}
+		return p.PointsTo
+	case '-':
+		if !isNumeric(t) {
+			r.errorf(u.Span, "cannot negate type %s", t)
+			return nil
+		}
+		ret = t
+	case '!':
+		if !isBool(t) {
+			r.errorf(u.Span, "operator ! requires a bool, got %s", t)
+			return nil
+		}
+		ret = t
+	default:
+		panic("internal error")
+	}
+	v, isConst := r.consts[u.Expr]
+	if isConst {
+		v, err := foldConstantUnop(u.Op, v)
+		if err != nil {
+			r.errorf(u.Span, "%s", err)
+			return nil
+		}
+		it, isInt := underlying(ret).(*GInt)
+		if iv, ok := v.(*big.Int); ok && isInt && !constantFitsInt(iv, it) {
+			r.errorf(u.Span, "constant %d overflows %s", iv, ret)
+			return nil
+		}
+		r.consts[u] = v
+	}
+	return ret
+}
+
+// Returns the type converted to if the call is a conversion T(x). The
+// type is nil if it had an error.
+func (r *Resolver) conversionType(c *parse.Call) (GType, bool) {
+	t, ok := r.typeExprs[c]
+	return t, ok
+}
+
+// Reports whether the call is a conversion T(x) rather than a function call.
+func (r *Resolver) IsConversion(c *parse.Call) bool {
+	_, ok := r.typeExprs[c]
+	return ok
+}
+
+func isPointer(t GType) bool {
+	_, ok := underlying(t).(*GPointer)
+	return ok
+}
+
+// Reports whether a value of type from may be converted to type to.
+// Types with the same underlying type convert freely, as do numeric types.
+// Pointers convert to other pointers and to and from uintptr.
+func (r *Resolver) isConvertible(from, to GType) bool {
+	uptr := underlying(getUintptrType(r.machine))
+	switch {
+	case underlying(from).Equals(underlying(to)):
+		return true
+	case isNumeric(from) && isNumeric(to):
+		return true
+	case isPointer(from) && isPointer(to):
+		return true
+	case isPointer(from) && isIntType(to):
+		return underlying(to).Equals(uptr)
+	case isIntType(from) && isPointer(to):
+		return underlying(from).Equals(uptr)
+	}
+	return false
+}
+
+// Conversions are written like a call of the type converted to.
+func (r *Resolver) checkConversion(c *parse.Call, to GType) GType {
+	if len(c.Args) != 1 {
+		r.errorf(c.Span, "conversion to %s takes exactly one argument", to)
+		return nil
+	}
+	arg := c.Args[0]
+	t := r.checkExpr(arg)
+	if t == nil || to == nil {
+		return nil
+	}
+	if isUntyped(t) {
+		// An integer constant becomes a pointer by way of uintptr.
+		convTo := to
+		if isPointer(to) && isInteger(t) {
+			convTo = getUintptrType(r.machine)
+		}
+		if !r.convertUntyped(arg, convTo) {
+			return nil
+		}
+		t = convTo
+	}
+	if !r.isConvertible(t, to) {
+		r.errorf(c.Span, "cannot convert %s to %s", t, to)
+		return nil
+	}
+	if v, isConst := r.consts[arg]; isConst {
+		switch {
+		case isNumeric(to):
+			var ok bool
+			v, ok = r.convertConstant(c.Span, v, to)
+			if !ok {
+				return nil
+			}
+		case isPointer(to) && v != nil:
+			// Only nil is a constant pointer.
+			return to
+		}
+		r.consts[c] = v
+	}
+	return to
+}
+
+// sizeof, alignof and offsetof are untyped constants computed from the
+// layout of their argument on the target machine. An expression argument
+// is not evaluated.
+func (r *Resolver) checkBuiltinCall(c *parse.Call, b *BuiltinSymbol) GType {
+	nargs := 1
+	if b.Name == "offsetof" {
+		nargs = 2
+	}
+	if len(c.Args) != nargs {
+		r.errorf(c.Span, "%s expects %d argument(s), got %d", b.Name, nargs, len(c.Args))
+		return nil
+	}
+	t, ok := r.typeExprs[c.Args[0]]
+	if !ok {
+		t = r.checkExpr(c.Args[0])
+		if t != nil && isUntyped(t) {
+			r.defaultUntyped(c.Args[0])
+			t = r.exprTypes[c.Args[0]]
+		}
+	}
+	if t == nil || isUntyped(t) {
+		return nil
+	}
+	if !hasLayout(t) {
+		r.errorf(c.Args[0].GetSpan(), "%s of %s is not defined", b.Name, t)
+		return nil
+	}
+	var v uint64
+	switch b.Name {
+	case "sizeof":
+		v = SizeOf(r.machine, t)
+	case "alignof":
+		v = AlignOf(r.machine, t)
+	case "offsetof":
+		field, ok := c.Args[1].(*parse.Ident)
+		if !ok {
+			r.errorf(c.Args[1].GetSpan(), "offsetof expects a field name")
+			return nil
+		}
+		st, ok := underlying(t).(*GStruct)
+		if !ok {
+			r.errorf(c.Args[0].GetSpan(), "offsetof expects a struct type, got %s", t)
+			return nil
+		}
+		idx := st.FieldIndex(field.Val)
+		if idx < 0 {
+			r.errorf(field.Span, "%s has no field %s", t, field.Val)
+			return nil
+		}
+		v = FieldOffset(r.machine, st, idx)
+	}
+	r.consts[c] = new(big.Int).SetUint64(v)
+	return &GConstant{}
+}
+
+func (r *Resolver) checkCall(c *parse.Call) GType {
+	if to, ok := r.conversionType(c); ok {
+		return r.checkConversion(c, to)
+	}
+	if ident, ok := c.FuncLike.(*parse.Ident); ok {
+		if b, ok := r.kv[ident].(*BuiltinSymbol); ok {
+			return r.checkBuiltinCall(c, b)
+		}
+	}
+	t := r.checkExpr(c.FuncLike)
+	if t == nil {
+		return nil
+	}
+	var ft *GFunc
+	p, ok := underlying(t).(*GPointer)
+	if ok {
+		ft, ok = underlying(p.PointsTo).(*GFunc)
+	}
+	if !ok {
+		r.errorf(c.Span, "calling non function type %s", t)
+		return nil
+	}
+	if len(c.Args) != len(ft.ArgTypes) {
+		r.errorf(c.Span, "expected %d argument(s), got %d", len(ft.ArgTypes), len(c.Args))
+		return nil
+	}
+	for idx, arg := range c.Args {
+		r.checkAssignable(ft.ArgTypes[idx], arg, "function call")
+	}
+	return ft.RetType
+}
+
+func (r *Resolver) checkIndex(i *parse.IndexInto) GType {
+	t := r.checkExpr(i.Expr)
+	it := r.checkExpr(i.Index)
+	if t == nil || it == nil {
+		return nil
+	}
+	if !isInteger(it) {
+		r.errorf(i.Index.GetSpan(), "index must be an integer, got %s", it)
+		return nil
+	}
+	r.defaultUntyped(i.Index)
+	switch t := underlying(t).(type) {
+	case *GArray:
+		idx, isConst := r.consts[i.Index]
+		if isConst && (idx.(*big.Int).Sign() < 0 || idx.(*big.Int).Cmp(new(big.Int).SetUint64(uint64(t.Dim))) >= 0) {
+			r.errorf(i.Index.GetSpan(), "index %d out of bounds for %s", idx, t)
+			return nil
+		}
+		return t.SubType
+	case *GPointer:
+		if isVoid(t.PointsTo) {
+			r.errorf(i.Span, "cannot index %s", t)
+			return nil
+		}
+		return t.PointsTo
+	case *GTuple:
+		// Each element has its own type, so the index must be known.
+		idx, isConst := r.consts[i.Index]
+		if !isConst {
+			r.errorf(i.Index.GetSpan(), "tuple index must be a constant")
+			return nil
+		}
+		if idx.(*big.Int).Sign() < 0 || idx.(*big.Int).Cmp(big.NewInt(int64(len(t.Types)))) >= 0 {
+			r.errorf(i.Index.GetSpan(), "index %s out of bounds for %s", idx, t)
+			return nil
+		}
+		return t.Types[idx.(*big.Int).Int64()]
+	}
+	r.errorf(i.Span, "cannot index type %s", t)
+	return nil
+}
+
+// Check a use of the symbol named by an Ident or a qualified pkg.Name.
+func (r *Resolver) checkSymbolRef(n parse.Node, name string, sym Symbol) GType {
+	switch sym := sym.(type) {
+	case nil:
+		// A name from a package which failed to import.
+		return nil
+	case *TypeSymbol:
+		r.errorf(n.GetSpan(), "type %s is not an expression", name)
+		return nil
+	case *BuiltinSymbol:
+		r.errorf(n.GetSpan(), "builtin %s must be called", name)
+		return nil
+	case *PackageSymbol:
+		r.errorf(n.GetSpan(), "use of package %s without selector", name)
+		return nil
+	case *ConstSymbol:
+		// Imported constants were checked with their package.
+		if sym.Decl != nil && r.kv[sym.Decl] == sym {
+			r.checkConstDecl(sym.Decl)
+			if sym.Type == nil {
+				return nil
+			}
+		}
+		r.consts[n] = sym.Val
+	case *GlobalSymbol:
+		if sym.Type == nil && sym.Decl.Type == nil {
+			r.errorf(n.GetSpan(), "%s is used before its type is inferred", name)
+			return nil
+		}
+	}
+	return symbolType(sym)
+}
+
+func (r *Resolver) checkSelector(s *parse.Selector) GType {
+	t := r.checkExpr(s.Expr)
+	if t == nil {
+		return nil
+	}
+	base := t
+	p, isPtr := underlying(t).(*GPointer)
+	if isPtr {
+		base = p.PointsTo
+	}
+	if u, ok := underlying(base).(*GTaggedUnion); ok {
+		idx := u.VariantIndex(s.Name)
+		if idx < 0 {
+			r.errorf(s.Span, "%s has no variant %s", base, s.Name)
+			return nil
+		}
+		// Reading a variant is only safe inside a match.
+		if r.variantTarget != s {
+			r.errorf(s.Span, "variant %s can only be assigned to, use match to access it", s.Name)
+			return nil
+		}
+		return u.Types[idx]
+	}
+	if u, ok := underlying(base).(*GUnion); ok {
+		idx := u.FieldIndex(s.Name)
+		if idx < 0 {
+			r.errorf(s.Span, "%s has no member %s", base, s.Name)
+			return nil
+		}
+		return u.Types[idx]
+	}
+	st, ok := underlying(base).(*GStruct)
+	if !ok {
+		r.errorf(s.Span, "selector on non struct type %s", t)
+		return nil
+	}
+	idx := st.FieldIndex(s.Name)
+	if idx < 0 {
+		r.errorf(s.Span, "%s has no field %s", base, s.Name)
+		return nil
+	}
+	return st.Types[idx]
+}
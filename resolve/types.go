@@ -2,8 +2,8 @@ package resolve
 
 import (
 	"fmt"
-	"github.com/andrewchambers/g/target"
 	"github.com/andrewchambers/g/parse"
+	"github.com/andrewchambers/g/target"
 )
 
 type GType interface {
@@ -16,9 +16,12 @@ type GStruct struct {
 	Types []GType
 }
 
+// Named types declared in a package other than main record the import
+// path of their package, so names from different packages stay distinct.
 type GNamedType struct {
 	Name string
 	Type GType
+	Pkg  string
 }
 
 type GInt struct {
@@ -26,6 +29,11 @@ type GInt struct {
 	Signed bool
 }
 
+// IEEE 754 binary32 or binary64, C float and double.
+type GFloat struct {
+	Bits uint
+}
+
 type GVoid struct {
 }
 
@@ -43,7 +51,41 @@ type GFunc struct {
 	ArgTypes []GType
 }
 
+// Tuples hold a fixed number of values of possibly different types.
+// They are laid out like a struct with unnamed fields. Functions with
+// multiple results return a tuple.
+type GTuple struct {
+	Types []GType
+}
+
+// The members of a union all start at offset zero, like a C union.
+type GUnion struct {
+	Names []string
+	Types []GType
+}
+
+// A tagged union holds a value of exactly one of its variants.
+// It is laid out like a C struct of a uint32_t tag followed by a union
+// of the variants, the tag holds the index of the active variant.
+type GTaggedUnion struct {
+	Names []string
+	Types []GType
+}
+
+// Enums are distinct integer types with a fixed set of named values,
+// members are numbered from zero in declaration order.
+type GEnum struct {
+	Type    *GInt
+	Members []string
+}
+
+// The type of untyped integer and float constants.
 type GConstant struct {
+	Float bool
+}
+
+// The type of nil before it is converted to a pointer type.
+type GNil struct {
 }
 
 var builtinVoidGType GType = &GVoid{}
@@ -56,32 +98,108 @@ var builtinUInt8GType GType = &GInt{8, false}
 var builtinUInt16GType GType = &GInt{16, false}
 var builtinUInt32GType GType = &GInt{32, false}
 var builtinUInt64GType GType = &GInt{64, false}
+var builtinFloat32GType GType = &GFloat{32}
+var builtinFloat64GType GType = &GFloat{64}
+
+// char is the element type of string literals, like C it is a signed byte.
+var builtinCharGType GType = &GNamedType{Name: "char", Type: builtinInt8GType}
+
+// int, uint and uintptr depend on the target, like char they are distinct
+// from the sized integer type of the same width.
+var builtinSizedGTypes = []*GNamedType{
+	{Name: "int", Type: builtinInt32GType},
+	{Name: "int", Type: builtinInt64GType},
+	{Name: "uint", Type: builtinUInt32GType},
+	{Name: "uint", Type: builtinUInt64GType},
+	{Name: "uintptr", Type: builtinUInt32GType},
+	{Name: "uintptr", Type: builtinUInt64GType},
+}
+
+// Returns the builtin type name with the given width, or nil if there
+// is no such type.
+func getBuiltinSizedType(name string, bits uint) *GNamedType {
+	for _, t := range builtinSizedGTypes {
+		if t.Name == name && t.Type.(*GInt).Bits == bits {
+			return t
+		}
+	}
+	return nil
+}
 
 func getDefaultIntType(tm target.TargetMachine) GType {
 	switch tm.DefaultIntBitWidth() {
-	case 32:
-		return builtinInt32GType
-	case 64:
-		return builtinInt64GType
+	case 32, 64:
+		return getBuiltinSizedType("int", tm.DefaultIntBitWidth())
+	}
+	panic("internal error")
+}
+
+// uint has the same width as int.
+func getUintType(tm target.TargetMachine) GType {
+	switch tm.DefaultIntBitWidth() {
+	case 32, 64:
+		return getBuiltinSizedType("uint", tm.DefaultIntBitWidth())
 	}
 	panic("internal error")
 }
 
+// uintptr is an unsigned integer large enough to hold a pointer.
+func getUintptrType(tm target.TargetMachine) GType {
+	switch tm.PointerBitWidth() {
+	case 32, 64:
+		return getBuiltinSizedType("uintptr", tm.PointerBitWidth())
+	}
+	panic("internal error")
+}
+
+// Strip any names from a type.
+func underlying(t GType) GType {
+	for {
+		named, ok := t.(*GNamedType)
+		if !ok {
+			return t
+		}
+		t = named.Type
+	}
+}
+
 func isBool(t GType) bool {
-	v, ok := t.(*GInt)
+	v, ok := underlying(t).(*GInt)
 	if ok {
 		return v.Bits == 1
 	}
 	return false
 }
 
+func isIntType(t GType) bool {
+	_, ok := underlying(t).(*GInt)
+	return ok
+}
+
+func isFloat(t GType) bool {
+	_, ok := underlying(t).(*GFloat)
+	return ok
+}
+
+func isEnum(t GType) bool {
+	_, ok := underlying(t).(*GEnum)
+	return ok
+}
+
+func isTuple(t GType) bool {
+	_, ok := underlying(t).(*GTuple)
+	return ok
+}
+
+func isVoid(t GType) bool {
+	_, ok := underlying(t).(*GVoid)
+	return ok
+}
+
+// A named type is only identical to itself, never to its underlying type.
+// Conversions compare underlying types instead.
 func (a *GNamedType) Equals(other GType) bool {
-	o, ok := other.(*GNamedType)
-	if !ok {
-		return a.Type.Equals(other)
-	} else {
-		return a.Type.Equals(o.Type)
-	}
+	return a == other
 }
 
 func (a *GNamedType) String() string {
@@ -112,15 +230,145 @@ func (p *GPointer) String() string {
 	return fmt.Sprintf("*%s", p.PointsTo.String())
 }
 
+func (t *GTuple) Equals(other GType) bool {
+	o, ok := other.(*GTuple)
+	if !ok {
+		return false
+	}
+	if len(o.Types) != len(t.Types) {
+		return false
+	}
+	for idx := range t.Types {
+		if !t.Types[idx].Equals(o.Types[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *GTuple) String() string {
+	ret := "("
+	for idx, sub := range t.Types {
+		ret += sub.String()
+		if idx != len(t.Types)-1 {
+			ret += ", "
+		}
+	}
+	return ret + ")"
+}
+
+// Returns the index of the named member, or -1 if there is no such member.
+func (u *GUnion) FieldIndex(name string) int {
+	for idx, n := range u.Names {
+		if n == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (u *GUnion) Equals(other GType) bool {
+	o, ok := other.(*GUnion)
+	if !ok {
+		return false
+	}
+	if len(o.Names) != len(u.Names) {
+		return false
+	}
+	for idx, name := range u.Names {
+		if o.Names[idx] != name {
+			return false
+		}
+		if !u.Types[idx].Equals(o.Types[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *GUnion) String() string {
+	ret := "union {"
+	for idx, name := range u.Names {
+		ret += fmt.Sprintf(" %s %s;", name, u.Types[idx])
+	}
+	return ret + " }"
+}
+
+func (u *GTaggedUnion) TagType() GType {
+	return builtinUInt32GType
+}
+
+// Returns the index of the named variant, or -1 if there is no such variant.
+func (u *GTaggedUnion) VariantIndex(name string) int {
+	for idx, n := range u.Names {
+		if n == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (u *GTaggedUnion) Equals(other GType) bool {
+	o, ok := other.(*GTaggedUnion)
+	if !ok {
+		return false
+	}
+	if len(o.Names) != len(u.Names) {
+		return false
+	}
+	for idx, name := range u.Names {
+		if o.Names[idx] != name {
+			return false
+		}
+		if !u.Types[idx].Equals(o.Types[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *GTaggedUnion) String() string {
+	ret := "tunion {"
+	for idx, name := range u.Names {
+		ret += fmt.Sprintf(" %s %s;", name, u.Types[idx])
+	}
+	return ret + " }"
+}
+
+func (e *GEnum) Equals(other GType) bool {
+	// Each enum declaration is a distinct type.
+	return e == other
+}
+
+func (e *GEnum) String() string {
+	ret := "enum {"
+	for _, m := range e.Members {
+		ret += " " + m
+	}
+	return ret + " }"
+}
+
 func (*GConstant) Equals(other GType) bool {
 	_, ok := other.(*GConstant)
 	return ok
 }
 
 func (c *GConstant) String() string {
+	if c.Float {
+		return "float constant"
+	}
 	return "constant"
 }
 
+func (*GNil) Equals(other GType) bool {
+	_, ok := other.(*GNil)
+	return ok
+}
+
+func (*GNil) String() string {
+	return "untyped nil"
+}
+
 func (*GVoid) Equals(other GType) bool {
 	_, ok := other.(*GVoid)
 	return ok
@@ -138,8 +386,31 @@ func (i *GInt) Equals(other GType) bool {
 	return i.Bits == oint.Bits && i.Signed == oint.Signed
 }
 
+func (f *GFloat) Equals(other GType) bool {
+	o, ok := other.(*GFloat)
+	return ok && o.Bits == f.Bits
+}
+
+func (f *GFloat) String() string {
+	return fmt.Sprintf("float%d", f.Bits)
+}
+
 func (s *GStruct) String() string {
-	return "GStruct"
+	ret := "struct {"
+	for idx, name := range s.Names {
+		ret += fmt.Sprintf(" %s %s;", name, s.Types[idx])
+	}
+	return ret + " }"
+}
+
+// Returns the index of the named field, or -1 if there is no such field.
+func (s *GStruct) FieldIndex(name string) int {
+	for idx, n := range s.Names {
+		if n == name {
+			return idx
+		}
+	}
+	return -1
 }
 
 func (s *GStruct) Equals(other GType) bool {
@@ -196,28 +467,46 @@ func (i *GInt) String() string {
 }
 
 func (f *GFunc) Equals(other GType) bool {
-	_, ok := other.(*GFunc)
+	o, ok := other.(*GFunc)
 	if !ok {
 		return false
 	}
-	panic("unimplemented")
+	if len(f.ArgTypes) != len(o.ArgTypes) {
+		return false
+	}
+	for idx := range f.ArgTypes {
+		if !f.ArgTypes[idx].Equals(o.ArgTypes[idx]) {
+			return false
+		}
+	}
+	return f.RetType.Equals(o.RetType)
 }
 
 func (f *GFunc) String() string {
-	return "function"
+	ret := "func ("
+	for idx, t := range f.ArgTypes {
+		ret += t.String()
+		if idx != len(f.ArgTypes)-1 {
+			ret += ", "
+		}
+	}
+	ret += ")"
+	if _, isVoid := f.RetType.(*GVoid); !isVoid {
+		ret += " " + f.RetType.String()
+	}
+	return ret
 }
 
-
-
-type typeLookupFunc func (*parse.Ident) (*GNamedType,error)
+// Looks up a type name, an Ident or a package qualified Selector.
+type typeLookupFunc func(parse.Node) (GType, *parse.Diagnostic)
 
 // Convert an AST node to a GType.
 // Requires a function to convert idents into named types.
 
-func astNodeToGType(lookup typeLookupFunc, n parse.Node) (GType,error) {
+func astNodeToGType(lookup typeLookupFunc, n parse.Node) (GType, *parse.Diagnostic) {
 	switch n := n.(type) {
-	case *parse.Ident:
-	    return lookup(n)
+	case *parse.Ident, *parse.Selector:
+		return lookup(n)
 	case *parse.PointerTo:
 		t, err := astNodeToGType(lookup, n.PointsTo)
 		if err != nil {
@@ -226,18 +515,18 @@ func astNodeToGType(lookup typeLookupFunc, n parse.Node) (GType,error) {
 		ret := &GPointer{PointsTo: t}
 		return ret, nil
 	case *parse.Struct:
-	ret := &GStruct{}
-	    for idx, name := range n.Names {
-		    t, err := astNodeToGType(lookup, n.Types[idx])
-		    if err != nil {
-			    return nil, err
-		    }
-		    ret.Names = append(ret.Names, name)
-		    ret.Types = append(ret.Types, t)
-	    }
-	    return ret, nil
+		ret := &GStruct{}
+		for idx, name := range n.Names {
+			t, err := astNodeToGType(lookup, n.Types[idx])
+			if err != nil {
+				return nil, err
+			}
+			ret.Names = append(ret.Names, name)
+			ret.Types = append(ret.Types, t)
+		}
+		return ret, nil
 	case *parse.ArrayOf:
-		t, err := astNodeToGType(lookup,n.SubType)
+		t, err := astNodeToGType(lookup, n.SubType)
 		if err != nil {
 			return nil, err
 		}
@@ -245,7 +534,42 @@ func astNodeToGType(lookup typeLookupFunc, n parse.Node) (GType,error) {
 		ret.Dim = n.Dim
 		ret.SubType = t
 		return ret, nil
+	case *parse.TupleOf:
+		ret := &GTuple{}
+		for _, sub := range n.Types {
+			t, err := astNodeToGType(lookup, sub)
+			if err != nil {
+				return nil, err
+			}
+			ret.Types = append(ret.Types, t)
+		}
+		return ret, nil
+	case *parse.Union:
+		ret := &GUnion{}
+		for idx, name := range n.Names {
+			t, err := astNodeToGType(lookup, n.Types[idx])
+			if err != nil {
+				return nil, err
+			}
+			ret.Names = append(ret.Names, name)
+			ret.Types = append(ret.Types, t)
+		}
+		return ret, nil
+	case *parse.TaggedUnion:
+		ret := &GTaggedUnion{}
+		for idx, name := range n.Names {
+			t, err := astNodeToGType(lookup, n.Types[idx])
+			if err != nil {
+				return nil, err
+			}
+			ret.Names = append(ret.Names, name)
+			ret.Types = append(ret.Types, t)
+		}
+		return ret, nil
+	case *parse.Enum:
+		// The members need a named type to belong to.
+		return nil, parse.Errorf(n.GetSpan(), "enum types must be declared with a name")
 	default:
-		return nil, fmt.Errorf("invalid type %v", n)
-	}  
+		return nil, parse.Errorf(n.GetSpan(), "invalid type")
+	}
 }
@@ -9,3 +9,7 @@ func (*X86_64_Linux_Target) LLVMTargetTriple() string {
 func (*X86_64_Linux_Target) DefaultIntBitWidth() uint {
 	return 64
 }
+
+func (*X86_64_Linux_Target) PointerBitWidth() uint {
+	return 64
+}
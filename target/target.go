@@ -11,6 +11,8 @@ type TargetMachine interface {
 	// The native width of machine registers
 	// This is used for default int size, and default array index type.
 	DefaultIntBitWidth() uint
+	// The size of a data pointer.
+	PointerBitWidth() uint
 }
 
 func GetTarget() TargetMachine {
@@ -9,3 +9,7 @@ func (*X86_Windows_Target) LLVMTargetTriple() string {
 func (*X86_Windows_Target) DefaultIntBitWidth() uint {
 	return 64
 }
+
+func (*X86_Windows_Target) PointerBitWidth() uint {
+	return 32
+}